@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defNativeHistogramBucketFactor is the default growth factor of native histogram buckets.
+const defNativeHistogramBucketFactor = 1.1
+
+// ExportType is the type of Prometheus metric timers and histograms are exported as.
+type ExportType int
+
+const (
+	// ExportSummary exports client-side quantiles as Prometheus Summary. Summaries can't be
+	// aggregated across instances.
+	ExportSummary ExportType = iota
+	// ExportHistogram exports Prometheus Histogram with classic buckets.
+	ExportHistogram
+	// ExportNativeHistogram exports Prometheus Histogram with native sparse buckets instead of classic ones.
+	// Classic buckets are exported as well only when AsHistogram precedes AsNativeHistogram.
+	ExportNativeHistogram
+)
+
+// ExportOption configures how timers and histograms are exported to Prometheus.
+// Expvar view of the metrics doesn't depend on export options.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	exportType   ExportType
+	objectives   map[float64]float64
+	buckets      []float64
+	bucketFactor float64
+}
+
+// AsSummary exports the metric as Prometheus Summary with the given quantile objectives.
+// This is the default, nil objectives mean the default objectives (0.5, 0.9 and 0.99 quantiles).
+func AsSummary(objectives map[float64]float64) ExportOption {
+	return func(o *exportOptions) {
+		o.exportType = ExportSummary
+		o.objectives = objectives
+	}
+}
+
+// AsHistogram exports the metric as Prometheus Histogram with the given upper bounds of buckets.
+// Nil buckets mean prometheus.DefBuckets. Timer buckets are in seconds.
+func AsHistogram(buckets []float64) ExportOption {
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+	return func(o *exportOptions) {
+		o.exportType = ExportHistogram
+		o.buckets = buckets
+	}
+}
+
+// AsExponentialHistogram exports the metric as Prometheus Histogram with count buckets,
+// where the lowest bucket has an upper bound of start and each following bucket's upper bound
+// is factor times the previous one.
+func AsExponentialHistogram(start, factor float64, count int) ExportOption {
+	return AsHistogram(prometheus.ExponentialBuckets(start, factor, count))
+}
+
+// AsNativeHistogram exports the metric as Prometheus native (sparse) Histogram without classic buckets,
+// unless they're set with AsHistogram passed before this option.
+// bucketFactor is the upper bound of the growth factor between two neighbouring buckets,
+// it defaults to 1.1 when it's not greater than 1.
+func AsNativeHistogram(bucketFactor float64) ExportOption {
+	return func(o *exportOptions) {
+		o.exportType = ExportNativeHistogram
+		o.bucketFactor = bucketFactor
+	}
+}
+
+func newExportOptions(opts []ExportOption) exportOptions {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// observerCollector is implemented by both prometheus.Summary and prometheus.Histogram.
+type observerCollector interface {
+	prometheus.Observer
+	prometheus.Collector
+}
+
+func (o exportOptions) summaryOpts(namespace, name, help string) prometheus.SummaryOpts {
+	objectives := o.objectives
+	if objectives == nil {
+		objectives = defObjectives
+	}
+	return prometheus.SummaryOpts{
+		Namespace:  namespace,
+		Name:       name,
+		Help:       help,
+		Objectives: objectives,
+	}
+}
+
+// histogramOpts returns options of the histogram. Buckets are nil unless set with AsHistogram,
+// which means prometheus.DefBuckets for classic histograms and no classic buckets for native ones.
+func (o exportOptions) histogramOpts(namespace, name, help string) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   o.buckets,
+	}
+	if o.exportType == ExportNativeHistogram {
+		opts.NativeHistogramBucketFactor = o.bucketFactor
+		if opts.NativeHistogramBucketFactor <= 1 {
+			opts.NativeHistogramBucketFactor = defNativeHistogramBucketFactor
+		}
+	}
+	return opts
+}
+
+// newObserver creates Prometheus collector of the configured export type.
+func (o exportOptions) newObserver(namespace, name, help string) observerCollector {
+	if o.exportType == ExportSummary {
+		return prometheus.NewSummary(o.summaryOpts(namespace, name, help))
+	}
+	return prometheus.NewHistogram(o.histogramOpts(namespace, name, help))
+}
+
+// newObserverVec creates Prometheus collector vector of the configured export type.
+func (o exportOptions) newObserverVec(namespace, name, help string, labelNames []string) prometheus.ObserverVec {
+	if o.exportType == ExportSummary {
+		return prometheus.NewSummaryVec(o.summaryOpts(namespace, name, help), labelNames)
+	}
+	return prometheus.NewHistogramVec(o.histogramOpts(namespace, name, help), labelNames)
+}
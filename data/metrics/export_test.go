@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterTimerExportTypes(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	summary := NewTimer()
+	r.NoError(reg.RegisterTimer("summary", summary))
+	histogram := NewTimer()
+	r.NoError(reg.RegisterTimer("histogram", histogram, AsHistogram([]float64{0.1, 1})))
+	exponential := NewHistogram()
+	r.NoError(reg.RegisterHistogram("exponential", exponential, "bytes", AsExponentialHistogram(1, 2, 4)))
+	native := NewTimer()
+	r.NoError(reg.RegisterTimer("native", native, AsNativeHistogram(0)))
+	both := NewTimer()
+	r.NoError(reg.RegisterTimer("both", both, AsHistogram(nil), AsNativeHistogram(0)))
+	hv := NewHistogramVec(VecOpts{LabelNames: []string{"kind"}})
+	r.NoError(reg.RegisterHistogramVec("vec", hv, "bytes", AsHistogram(nil)))
+
+	for _, timer := range []*Timer{summary, histogram, native, both} {
+		timer.Time(func() { time.Sleep(time.Millisecond) })
+	}
+	exponential.Update(3)
+	hv.WithLabelValues("a").Update(3)
+
+	mfs, err := preg.Gather()
+	r.NoError(err)
+
+	types := make(map[string]dto.MetricType)
+	for _, mf := range mfs {
+		types[mf.GetName()] = mf.GetType()
+		if mf.GetName() == "test_exponential_bytes" {
+			r.Len(mf.GetMetric()[0].GetHistogram().GetBucket(), 4)
+		}
+		if mf.GetName() == "test_native_seconds" {
+			r.NotZero(mf.GetMetric()[0].GetHistogram().GetSchema())
+			r.Empty(mf.GetMetric()[0].GetHistogram().GetBucket())
+		}
+		if mf.GetName() == "test_both_seconds" {
+			r.NotZero(mf.GetMetric()[0].GetHistogram().GetSchema())
+			r.Len(mf.GetMetric()[0].GetHistogram().GetBucket(), len(prometheus.DefBuckets))
+		}
+	}
+	r.Equal(map[string]dto.MetricType{
+		"test_summary_seconds":   dto.MetricType_SUMMARY,
+		"test_histogram_seconds": dto.MetricType_HISTOGRAM,
+		"test_exponential_bytes": dto.MetricType_HISTOGRAM,
+		"test_native_seconds":    dto.MetricType_HISTOGRAM,
+		"test_both_seconds":      dto.MetricType_HISTOGRAM,
+		"test_vec_bytes":         dto.MetricType_HISTOGRAM,
+	}, types)
+}
@@ -1,15 +1,21 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"expvar"
+	"fmt"
 	"math"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rcrowley/go-metrics"
+	"go.uber.org/zap"
 )
 
 var (
@@ -45,70 +51,256 @@ func systemUTCUnixMs() int64 {
 	return time.Now().UTC().UnixNano() / 1e6
 }
 
+// callbacks is a list of callbacks safe for concurrent use. Callbacks are added and removed
+// by copying the list, so calling them doesn't block on registration.
+type callbacks[F any] struct {
+	mu     sync.Mutex
+	nextID int
+	list   atomic.Pointer[[]callback[F]]
+}
+
+type callback[F any] struct {
+	id int
+	f  F
+}
+
+// add adds the callback, returned function removes it.
+func (cs *callbacks[F]) add(f F) (remove func()) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	id := cs.nextID
+	cs.nextID++
+
+	list := append(cs.load(), callback[F]{id: id, f: f})
+	cs.list.Store(&list)
+
+	return func() {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+
+		old := cs.load()
+		list := make([]callback[F], 0, len(old))
+		for _, c := range old {
+			if c.id != id {
+				list = append(list, c)
+			}
+		}
+		cs.list.Store(&list)
+	}
+}
+
+// load returns the current callbacks, the returned slice must not be modified.
+func (cs *callbacks[F]) load() []callback[F] {
+	if list := cs.list.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
 type markCallback func(int64)
 
 // Rate tracks the rate of values per second
 type Rate struct {
 	m  metrics.Meter
-	cs []markCallback
+	cs callbacks[markCallback]
 }
 
 // NewRate creates a new rate metric
 func NewRate() *Rate {
-	meter := metrics.NewMeter()
-	return &Rate{meter,
-		[]markCallback{func(n int64) {
-			meter.Mark(n)
-		}}}
+	rate := &Rate{m: metrics.NewMeter()}
+	rate.cs.add(rate.m.Mark)
+	return rate
 }
 
 // Mark records the occurance of n events.
 func (r *Rate) Mark(n int64) {
-	for _, markCallback := range r.cs {
-		markCallback(n)
+	for _, c := range r.cs.load() {
+		c.f(n)
 	}
 }
 
-func (r *Rate) registerMarkCallback(c markCallback) {
+func (r *Rate) registerMarkCallback(c markCallback) (remove func()) {
 	if c == nil {
 		panic("nil rate mark callback")
 	}
-	r.cs = append(r.cs, c)
+	return r.cs.add(c)
 }
 
 type timeCallback func(time.Duration)
 
+// Outcomes of timed operations.
+const (
+	OutcomeOK       = "ok"
+	OutcomeError    = "error"
+	OutcomeCanceled = "canceled"
+	OutcomeTimeout  = "timeout"
+)
+
+// maxOutcomes limits the number of distinct outcomes tracked by a timer.
+const maxOutcomes = 20
+
 // Timer capture the duration and rate of events.
 type Timer struct {
 	t  metrics.Timer
-	cs []timeCallback
+	cs callbacks[timeCallback]
+
+	// outcomes captures durations by outcome, shared by children of a timer vector.
+	outcomes *timerOutcomes
+	lvs      []string // label values of timer vector children
 }
 
 // NewTimer constructs a new Timer using an exponentially-decaying
 // sample with the same reservoir size and alpha as UNIX load averages.
 func NewTimer() *Timer {
-	timer := metrics.NewTimer()
-	return &Timer{timer,
-		[]timeCallback{func(duration time.Duration) {
-			timer.Update(duration)
-		}}}
+	timer := newTimer()
+	timer.outcomes = newTimerOutcomes(nil, 1)
+	return timer
+}
+
+func newTimer() *Timer {
+	timer := &Timer{t: metrics.NewTimer()}
+	timer.cs.add(timer.t.Update)
+	return timer
 }
 
 // Time record the duration of the execution of the given function.
 func (t *Timer) Time(f func()) {
 	ts := time.Now()
 	f()
-	duration := time.Since(ts)
-	for _, timeCallback := range t.cs {
-		timeCallback(duration)
+	t.Update(time.Since(ts))
+}
+
+// TimeErr records the duration of the execution of the given function and its outcome:
+// OutcomeOK when the function returns nil error, OutcomeError otherwise. The error is returned as is.
+func (t *Timer) TimeErr(f func() error) error {
+	stop := t.StartOutcome()
+	err := f()
+	stop(errOutcome(nil, err))
+	return err
+}
+
+// TimeCtx records the duration of the execution of the given function and its outcome.
+// Besides OutcomeOK and OutcomeError, OutcomeTimeout and OutcomeCanceled are recorded
+// when the function fails because the context deadline is exceeded or the context is canceled.
+func (t *Timer) TimeCtx(ctx context.Context, f func(ctx context.Context) error) error {
+	stop := t.StartOutcome()
+	err := f(ctx)
+	stop(errOutcome(ctx, err))
+	return err
+}
+
+// Start starts timing an event, the duration is recorded when the returned function is called.
+func (t *Timer) Start() (stop func()) {
+	ts := time.Now()
+	return func() {
+		t.Update(time.Since(ts))
+	}
+}
+
+// StartOutcome starts timing an event, the duration is recorded together with
+// the given outcome (e.g. OutcomeOK or a custom one) when the returned function is called.
+func (t *Timer) StartOutcome() (stop func(outcome string)) {
+	ts := time.Now()
+	return func(outcome string) {
+		t.UpdateOutcome(time.Since(ts), outcome)
+	}
+}
+
+// Update records the duration of an event.
+func (t *Timer) Update(duration time.Duration) {
+	for _, c := range t.cs.load() {
+		c.f(duration)
+	}
+}
+
+// UpdateOutcome records the duration of an event with the given outcome.
+// Durations by outcome are exported under the timer name with "_outcome" suffix and "outcome" label,
+// which is created on the first outcome, so timers without outcomes export no additional series.
+// Outcomes of timer vector children are exported by the vector with "outcome" label following the vector labels.
+func (t *Timer) UpdateOutcome(duration time.Duration, outcome string) {
+	t.Update(duration)
+	if t.outcomes != nil {
+		lvs := append(t.lvs[:len(t.lvs):len(t.lvs)], outcome)
+		t.outcomes.get().WithLabelValues(lvs...).Update(duration)
+	}
+}
+
+// timerOutcomes holds durations of a timer, or children of a timer vector, by outcome.
+// The vector of durations is created on the first outcome.
+type timerOutcomes struct {
+	opts VecOpts
+
+	mu    sync.Mutex
+	tv    *TimerVec
+	hooks callbacks[func(*TimerVec)]
+}
+
+// newTimerOutcomes creates outcomes of timers labelled with the label names,
+// maxCardinality is the maximum number of label combinations of the timers.
+func newTimerOutcomes(labelNames []string, maxCardinality int) *timerOutcomes {
+	return &timerOutcomes{opts: VecOpts{
+		LabelNames:     append(labelNames[:len(labelNames):len(labelNames)], "outcome"),
+		MaxCardinality: maxCardinality * maxOutcomes,
+	}}
+}
+
+// get returns the vector of durations, creating it if needed.
+func (o *timerOutcomes) get() *TimerVec {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.tv == nil {
+		o.tv = NewTimerVec(o.opts)
+		for _, c := range o.hooks.load() {
+			c.f(o.tv)
+		}
+	}
+	return o.tv
+}
+
+// onCreate calls the hook with the vector of durations once it's created, or right away when it exists.
+// Returned function removes the hook, once it returns the hook is not running and won't be called.
+func (o *timerOutcomes) onCreate(hook func(*TimerVec)) (remove func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.tv != nil {
+		hook(o.tv)
+		return func() {}
+	}
+
+	removeHook := o.hooks.add(hook)
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		removeHook()
 	}
 }
 
-func (t *Timer) registerTimeCallback(c timeCallback) {
+// errOutcome returns outcome of an operation by its error.
+func errOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, context.DeadlineExceeded):
+		return OutcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case ctx != nil && ctx.Err() == context.DeadlineExceeded:
+		return OutcomeTimeout
+	case ctx != nil && ctx.Err() == context.Canceled:
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
+
+func (t *Timer) registerTimeCallback(c timeCallback) (remove func()) {
 	if c == nil {
 		panic("nil timer time callback")
 	}
-	t.cs = append(t.cs, c)
+	return t.cs.add(c)
 }
 
 type updateCallback func(int64)
@@ -116,30 +308,28 @@ type updateCallback func(int64)
 // Gauge hold an int64 value that can be set arbitrarily
 type Gauge struct {
 	g  metrics.Gauge
-	cs []updateCallback
+	cs callbacks[updateCallback]
 }
 
 // NewGauge constructs a new Gauge
 func NewGauge() *Gauge {
-	gauge := metrics.NewGauge()
-	return &Gauge{gauge,
-		[]updateCallback{func(v int64) {
-			gauge.Update(v)
-		}}}
+	gauge := &Gauge{g: metrics.NewGauge()}
+	gauge.cs.add(gauge.g.Update)
+	return gauge
 }
 
 // Update updates the gauge's value
 func (g *Gauge) Update(v int64) {
-	for _, updateCallback := range g.cs {
-		updateCallback(v)
+	for _, c := range g.cs.load() {
+		c.f(v)
 	}
 }
 
-func (g *Gauge) registerUpdateCallback(c updateCallback) {
+func (g *Gauge) registerUpdateCallback(c updateCallback) (remove func()) {
 	if c == nil {
 		panic("nil gauge update callback")
 	}
-	g.cs = append(g.cs, c)
+	return g.cs.add(c)
 }
 
 // Value returns the gauge's current value
@@ -150,30 +340,28 @@ func (g *Gauge) Value() int64 {
 // Histogram calculate distribution statistics from a series of int64 values.
 type Histogram struct {
 	h  metrics.Histogram
-	cs []updateCallback
+	cs callbacks[updateCallback]
 }
 
 // NewHistogram constructs a new Histogram.
 func NewHistogram() *Histogram {
-	histogram := metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
-	return &Histogram{histogram,
-		[]updateCallback{func(v int64) {
-			histogram.Update(v)
-		}}}
+	histogram := &Histogram{h: metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))}
+	histogram.cs.add(histogram.h.Update)
+	return histogram
 }
 
 // Update samples a new value.
 func (h *Histogram) Update(v int64) {
-	for _, updateCallback := range h.cs {
-		updateCallback(v)
+	for _, c := range h.cs.load() {
+		c.f(v)
 	}
 }
 
-func (h *Histogram) registerUpdateCallback(c updateCallback) {
+func (h *Histogram) registerUpdateCallback(c updateCallback) (remove func()) {
 	if c == nil {
 		panic("nil histogram update callback")
 	}
-	h.cs = append(h.cs, c)
+	return h.cs.add(c)
 }
 
 // Registry is a registry of all metrics
@@ -181,23 +369,286 @@ type Registry struct {
 	m     *expvar.Map
 	r     metrics.Registry
 	pName string // full register name in Prometheus format (includes parent registry name)
+	preg  prometheus.Registerer
+
+	mu         sync.Mutex
+	collectors map[string]prometheus.Collector // Prometheus collectors by metric name, used to unregister
+	cleanups   map[string][]func()             // additional unregister actions by metric name
+}
+
+// RegistryOption configures a Registry created by NewRegistry.
+type RegistryOption func(*registryOptions)
+
+type registryOptions struct {
+	registerer prometheus.Registerer
+	expvarRoot *expvar.Map
+}
+
+// WithRegisterer sets the Prometheus registerer metrics are registered with.
+// Defaults to prometheus.DefaultRegisterer.
+func WithRegisterer(reg prometheus.Registerer) RegistryOption {
+	return func(o *registryOptions) {
+		o.registerer = reg
+	}
+}
+
+// WithExpvarRoot sets the expvar map the registry node is added to.
+// By default the registry node is published as a top-level expvar variable.
+func WithExpvarRoot(root *expvar.Map) RegistryOption {
+	return func(o *registryOptions) {
+		o.expvarRoot = root
+	}
 }
 
 // NewRegistry creates a new Registry.
 // name parameter is used as a root node name
-func NewRegistry(name string) *Registry {
-	return &Registry{expvar.NewMap(name), metrics.NewPrefixedRegistry(name), toPrometheusName(name)}
+func NewRegistry(name string, opts ...RegistryOption) *Registry {
+	o := registryOptions{registerer: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var m *expvar.Map
+	if o.expvarRoot != nil {
+		m = childExpvarMap(o.expvarRoot, name)
+	} else if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		// reusing already published node, expvar.NewMap panics on duplicate names
+		m = v
+	} else {
+		m = expvar.NewMap(name)
+	}
+
+	return newRegistry(m, metrics.NewPrefixedRegistry(name), toPrometheusName(name), o.registerer)
+}
+
+func newRegistry(m *expvar.Map, r metrics.Registry, pName string, preg prometheus.Registerer) *Registry {
+	return &Registry{
+		m:          m,
+		r:          r,
+		pName:      pName,
+		preg:       preg,
+		collectors: make(map[string]prometheus.Collector),
+		cleanups:   make(map[string][]func()),
+	}
 }
 
 // CreateSubRegistry creates inner Registry with the give name.
 func (r *Registry) CreateSubRegistry(name string) *Registry {
+	return newRegistry(childExpvarMap(r.m, name), metrics.NewPrefixedChildRegistry(r.r, "."+name), r.pName+"_"+toPrometheusName(name), r.preg)
+}
+
+// Unregister removes the metric with the given name from expvar, Prometheus and go-metrics registries.
+// The metric itself stays usable, but its values are no longer exported. Prometheus collectors shared
+// with other registries (see registerCollector) stay registered until all of them unregister the metric.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	c, ok := r.collectors[name]
+	delete(r.collectors, name)
+	cleanups := r.cleanups[name]
+	delete(r.cleanups, name)
+	r.mu.Unlock()
+
+	if ok && c != nil && sharedCollectors.release(c) {
+		r.preg.Unregister(c)
+	}
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+	sharedVars.delete(r, name)
+	r.r.Unregister("." + name)
+}
+
+// setVar exports the metric variable to expvar under the name.
+func (r *Registry) setVar(name string, v expvar.Var) {
+	sharedVars.set(r, name, v)
+}
+
+// addCleanup adds the action run when the metric is unregistered.
+func (r *Registry) addCleanup(name string, cleanup func()) {
+	r.mu.Lock()
+	r.cleanups[name] = append(r.cleanups[name], cleanup)
+	r.mu.Unlock()
+}
+
+// childExpvarMap returns the map stored under the name in the parent map, creating it if needed.
+func childExpvarMap(parent *expvar.Map, name string) *expvar.Map {
+	if v, ok := parent.Get(name).(*expvar.Map); ok {
+		return v
+	}
 	v := new(expvar.Map).Init()
+	parent.Set(name, v)
+	return v
+}
+
+// registerMetric registers the metric in go-metrics registry first, so duplicate names are reported
+// before anything is exported to expvar or Prometheus. Names of vectors are reserved by their collectors.
+func (r *Registry) registerMetric(name string, i interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[name]; ok {
+		return metrics.DuplicateMetric(name)
+	}
+	return r.r.Register("."+name, i)
+}
+
+// checkName returns an error when the metric name is taken, without reserving it.
+func (r *Registry) checkName(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[name]; ok || r.r.Get("."+name) != nil {
+		return metrics.DuplicateMetric(name)
+	}
+	return nil
+}
+
+// expvarKey is a variable of an expvar map.
+type expvarKey struct {
+	m    *expvar.Map
+	name string
+}
+
+// expvarEntry is a variable set by a registry.
+type expvarEntry struct {
+	r *Registry
+	v expvar.Var
+}
+
+// expvarRefs tracks variables of registries sharing expvar maps, e.g. registries with the same name.
+type expvarRefs struct {
+	mu   sync.Mutex
+	vars map[expvarKey][]expvarEntry
+}
+
+var sharedVars = expvarRefs{vars: make(map[expvarKey][]expvarEntry)}
+
+// set exports the variable of the registry, the variable set last is exported.
+func (er *expvarRefs) set(r *Registry, name string, v expvar.Var) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	k := expvarKey{m: r.m, name: name}
+	er.vars[k] = append(er.vars[k], expvarEntry{r: r, v: v})
 	r.m.Set(name, v)
-	return &Registry{v, metrics.NewPrefixedChildRegistry(r.r, "."+name), r.pName + "_" + toPrometheusName(name)}
+}
+
+// delete removes the variable of the registry. The variable is deleted from the map once no registry
+// sharing the map has it, otherwise the variable of another registry is exported.
+func (er *expvarRefs) delete(r *Registry, name string) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	k := expvarKey{m: r.m, name: name}
+	entries, ok := er.vars[k]
+	if !ok {
+		return
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.r != r {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(entries) {
+		return
+	}
+	if len(kept) == 0 {
+		delete(er.vars, k)
+		r.m.Delete(name)
+		return
+	}
+	er.vars[k] = kept
+	r.m.Set(name, kept[len(kept)-1].v)
+}
+
+// collectorRefs counts registries sharing Prometheus collectors.
+type collectorRefs struct {
+	mu   sync.Mutex
+	refs map[prometheus.Collector]int
+}
+
+var sharedCollectors = collectorRefs{refs: make(map[prometheus.Collector]int)}
+
+// acquire adds a reference to the collector. Collectors registered outside of the package
+// get an extra reference, so they're never unregistered.
+func (cr *collectorRefs) acquire(c prometheus.Collector, registered bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, ok := cr.refs[c]; !ok && !registered {
+		cr.refs[c] = 1
+	}
+	cr.refs[c]++
+}
+
+// release removes a reference to the collector and reports whether it was the last one.
+func (cr *collectorRefs) release(c prometheus.Collector) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.refs[c]--
+	if cr.refs[c] > 0 {
+		return false
+	}
+	delete(cr.refs, c)
+	return true
+}
+
+// registerCollector registers Prometheus collector under the metric name. When an equal collector
+// is already registered (e.g. by another Registry with the same name), the existing one is returned
+// and shared by the registries.
+func registerCollector[T prometheus.Collector](r *Registry, name string, c T) (T, error) {
+	registered := true
+	if err := r.preg.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return c, err
+		}
+		existing, ok := are.ExistingCollector.(T)
+		if !ok {
+			return c, fmt.Errorf("metrics: collector for %q is already registered with a different type", name)
+		}
+		c, registered = existing, false
+	}
+	sharedCollectors.acquire(c, registered)
+
+	r.mu.Lock()
+	r.collectors[name] = c
+	r.mu.Unlock()
+
+	return c, nil
 }
 
 // RegisterRate registers a new rate metric or returns an error
 func (r *Registry) RegisterRate(name string, rate *Rate) error {
+	if err := r.registerMetric(name, rate.m); err != nil {
+		return err
+	}
+
+	r.setVar(name, rateVar(rate))
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: r.pName,
+		Name:      toPrometheusName(name + "_total"),
+		Help:      name,
+	})
+	counter, err := registerCollector(r, name, counter)
+	if err != nil {
+		r.Unregister(name)
+		return err
+	}
+
+	r.addCleanup(name, rate.registerMarkCallback(func(v int64) {
+		counter.Add(float64(v))
+	}))
+
+	return nil
+}
+
+// rateVar returns expvar variable rendering the rate snapshot.
+func rateVar(rate *Rate) expvar.Var {
 	count := new(expvar.Int)
 	oneMinute := new(expvar.Float)
 	fiveMinute := new(expvar.Float)
@@ -211,7 +662,7 @@ func (r *Registry) RegisterRate(name string, rate *Rate) error {
 	m.Set("fifteen-minute", fifteenMinute)
 	m.Set("mean", mean)
 
-	r.m.Set(name, varFunc(func() expvar.Var {
+	return varFunc(func() expvar.Var {
 		s := rate.m.Snapshot()
 		count.Set(s.Count())
 		oneMinute.Set(s.Rate1())
@@ -219,20 +670,7 @@ func (r *Registry) RegisterRate(name string, rate *Rate) error {
 		fifteenMinute.Set(s.Rate15())
 		mean.Set(s.RateMean())
 		return m
-	}))
-
-	counter := prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: r.pName,
-		Name:      toPrometheusName(name + "_total"),
-		Help:      name,
-	})
-	prometheus.MustRegister(counter)
-
-	rate.registerMarkCallback(func(v int64) {
-		counter.Add(float64(v))
 	})
-
-	return r.r.Register("."+name, rate.m)
 }
 
 var (
@@ -257,8 +695,59 @@ func init() {
 	}
 }
 
-// RegisterTimer registers a new timer under the given name or returns an error
-func (r *Registry) RegisterTimer(name string, timer *Timer) error {
+// RegisterTimer registers a new timer under the given name or returns an error.
+// By default the timer is exported to Prometheus as Summary, see ExportOption for alternatives.
+// The name with "_outcome" suffix must be free for outcomes, see Timer.UpdateOutcome.
+func (r *Registry) RegisterTimer(name string, timer *Timer, opts ...ExportOption) error {
+	if err := r.checkName(name + "_outcome"); err != nil {
+		return err
+	}
+	if err := r.registerMetric(name, timer.t); err != nil {
+		return err
+	}
+
+	r.setVar(name, timerVar(timer))
+
+	observer := newExportOptions(opts).newObserver(r.pName, toPrometheusName(name+"_seconds"), name)
+	observer, err := registerCollector(r, name, observer)
+	if err != nil {
+		r.Unregister(name)
+		return err
+	}
+
+	r.addCleanup(name, timer.registerTimeCallback(func(duration time.Duration) {
+		observer.Observe(duration.Seconds())
+	}))
+	r.addCleanup(name, r.registerOutcomes(name, timer.outcomes, opts))
+
+	return nil
+}
+
+// registerOutcomes registers durations by outcome under the name with "_outcome" suffix once
+// the first outcome is recorded. Callers check the name is free beforehand, as the registration error
+// can't be returned then, it's logged. Returned function unregisters them.
+func (r *Registry) registerOutcomes(name string, outcomes *timerOutcomes, opts []ExportOption) (cleanup func()) {
+	outcomeName := name + "_outcome"
+
+	var registered atomic.Bool
+	remove := outcomes.onCreate(func(tv *TimerVec) {
+		if err := r.RegisterTimerVec(outcomeName, tv, opts...); err != nil {
+			zap.L().Warn("metrics: timer outcomes are not exported", zap.String("name", outcomeName), zap.Error(err))
+			return
+		}
+		registered.Store(true)
+	})
+
+	return func() {
+		remove()
+		if registered.Load() {
+			r.Unregister(outcomeName)
+		}
+	}
+}
+
+// timerVar returns expvar variable rendering the timer snapshot.
+func timerVar(timer *Timer) expvar.Var {
 	count := new(expvar.Int)
 	min := new(expvar.Int)
 	max := new(expvar.Int)
@@ -286,7 +775,7 @@ func (r *Registry) RegisterTimer(name string, timer *Timer) error {
 		m.Set(tp.name, v)
 	}
 
-	r.m.Set(name, varFunc(func() expvar.Var {
+	return varFunc(func() expvar.Var {
 		s := timer.t.Snapshot()
 		count.Set(s.Count())
 		min.Set(s.Min())
@@ -302,21 +791,7 @@ func (r *Registry) RegisterTimer(name string, timer *Timer) error {
 			percentileVars[i].Set(ceilTime(pv))
 		}
 		return m
-	}))
-
-	summary := prometheus.NewSummary(prometheus.SummaryOpts{
-		Namespace:  r.pName,
-		Name:       toPrometheusName(name + "_seconds"),
-		Help:       name,
-		Objectives: defObjectives,
-	})
-	prometheus.MustRegister(summary)
-
-	timer.registerTimeCallback(func(duration time.Duration) {
-		summary.Observe(duration.Seconds())
 	})
-
-	return r.r.Register("."+name, timer.t)
 }
 
 // RegisterGauge registers a new gauge under the given name or returns an error
@@ -325,26 +800,39 @@ func (r *Registry) RegisterGauge(name string, gauge *Gauge, units string) error
 		panic("expected non empty units")
 	}
 
-	value := new(expvar.Int)
+	if err := r.registerMetric(name, gauge.g); err != nil {
+		return err
+	}
 
-	r.m.Set(name, varFunc(func() expvar.Var {
-		s := gauge.g.Snapshot()
-		value.Set(s.Value())
-		return value
-	}))
+	r.setVar(name, gaugeVar(gauge))
 
 	pgauge := prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: r.pName,
 		Name:      toPrometheusName(name + "_" + units),
 		Help:      name,
 	})
-	prometheus.MustRegister(pgauge)
+	pgauge, err := registerCollector(r, name, pgauge)
+	if err != nil {
+		r.Unregister(name)
+		return err
+	}
 
-	gauge.registerUpdateCallback(func(v int64) {
+	r.addCleanup(name, gauge.registerUpdateCallback(func(v int64) {
 		pgauge.Set(float64(v))
-	})
+	}))
 
-	return r.r.Register("."+name, gauge.g)
+	return nil
+}
+
+// gaugeVar returns expvar variable rendering the gauge snapshot.
+func gaugeVar(gauge *Gauge) expvar.Var {
+	value := new(expvar.Int)
+
+	return varFunc(func() expvar.Var {
+		s := gauge.g.Snapshot()
+		value.Set(s.Value())
+		return value
+	})
 }
 
 func ceilTime(v float64) int64 {
@@ -362,12 +850,35 @@ func (r *Registry) GetMetricsRegistry() metrics.Registry {
 	return r.r
 }
 
-// RegisterHistogram registers a new histogram under the given name or returns an error
-func (r *Registry) RegisterHistogram(name string, histogram *Histogram, units string) error {
+// RegisterHistogram registers a new histogram under the given name or returns an error.
+// By default the histogram is exported to Prometheus as Summary, see ExportOption for alternatives.
+func (r *Registry) RegisterHistogram(name string, histogram *Histogram, units string, opts ...ExportOption) error {
 	if len(units) == 0 {
 		panic("expected non empty units")
 	}
 
+	if err := r.registerMetric(name, histogram.h); err != nil {
+		return err
+	}
+
+	r.setVar(name, histogramVar(histogram))
+
+	observer := newExportOptions(opts).newObserver(r.pName, toPrometheusName(name+"_"+units), name)
+	observer, err := registerCollector(r, name, observer)
+	if err != nil {
+		r.Unregister(name)
+		return err
+	}
+
+	r.addCleanup(name, histogram.registerUpdateCallback(func(v int64) {
+		observer.Observe(float64(v))
+	}))
+
+	return nil
+}
+
+// histogramVar returns expvar variable rendering the histogram snapshot.
+func histogramVar(histogram *Histogram) expvar.Var {
 	count := new(expvar.Int)
 	min := new(expvar.Int)
 	max := new(expvar.Int)
@@ -387,7 +898,7 @@ func (r *Registry) RegisterHistogram(name string, histogram *Histogram, units st
 		m.Set(tp.name, v)
 	}
 
-	r.m.Set(name, varFunc(func() expvar.Var {
+	return varFunc(func() expvar.Var {
 		s := histogram.h.Snapshot()
 		count.Set(s.Count())
 		min.Set(s.Min())
@@ -399,21 +910,7 @@ func (r *Registry) RegisterHistogram(name string, histogram *Histogram, units st
 			percentileVars[i].Set(pv)
 		}
 		return m
-	}))
-
-	summary := prometheus.NewSummary(prometheus.SummaryOpts{
-		Namespace:  r.pName,
-		Name:       toPrometheusName(name + "_" + units),
-		Help:       name,
-		Objectives: defObjectives,
 	})
-	prometheus.MustRegister(summary)
-
-	histogram.registerUpdateCallback(func(v int64) {
-		summary.Observe(float64(v))
-	})
-
-	return r.r.Register("."+name, histogram.h)
 }
 
 func toPrometheusName(name string) string {
@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestRegistry(name string) (*Registry, *prometheus.Registry) {
+	preg := prometheus.NewRegistry()
+	return NewRegistry(name, WithRegisterer(preg), WithExpvarRoot(new(expvar.Map).Init())), preg
+}
+
+func TestRegistryDuplicateRegistration(t *testing.T) {
+	r := require.New(t)
+
+	reg, _ := newTestRegistry("test")
+
+	r.NoError(reg.RegisterRate("requests", NewRate()))
+	r.Error(reg.RegisterRate("requests", NewRate()))
+}
+
+func TestRegistrySharedRegisterer(t *testing.T) {
+	r := require.New(t)
+
+	preg := prometheus.NewRegistry()
+	reg1 := NewRegistry("shared", WithRegisterer(preg), WithExpvarRoot(new(expvar.Map).Init()))
+	reg2 := NewRegistry("shared", WithRegisterer(preg), WithExpvarRoot(new(expvar.Map).Init()))
+
+	rate1 := NewRate()
+	rate2 := NewRate()
+	r.NoError(reg1.RegisterRate("requests", rate1))
+	r.NoError(reg2.RegisterRate("requests", rate2))
+
+	rate1.Mark(2)
+	rate2.Mark(3)
+
+	r.Equal(1, testutil.CollectAndCount(preg))
+	count, err := testutil.GatherAndCount(preg, "shared_requests_total")
+	r.NoError(err)
+	r.Equal(1, count)
+
+	// the collector is exported until both registries unregister it
+	reg1.Unregister("requests")
+	rate2.Mark(1)
+	r.Equal(1, testutil.CollectAndCount(preg))
+	r.Equal(float64(6), testutil.ToFloat64(reg2.collectors["requests"]))
+
+	reg2.Unregister("requests")
+	r.Equal(0, testutil.CollectAndCount(preg))
+}
+
+func TestRegistrySharedExpvar(t *testing.T) {
+	r := require.New(t)
+
+	// registries with the same name share the expvar node
+	root := new(expvar.Map).Init()
+	reg1 := NewRegistry("shared", WithRegisterer(prometheus.NewRegistry()), WithExpvarRoot(root))
+	reg2 := NewRegistry("shared", WithRegisterer(prometheus.NewRegistry()), WithExpvarRoot(root))
+	r.Same(reg1.m, reg2.m)
+
+	r.NoError(reg1.RegisterGauge("connections", NewGauge(), "count"))
+	gauge2 := NewGauge()
+	r.NoError(reg2.RegisterGauge("connections", gauge2, "count"))
+	gauge2.Update(7)
+
+	// the metric of the other registry stays exported
+	reg2.Unregister("connections")
+	r.NotNil(reg1.m.Get("connections"))
+	r.NoError(reg2.RegisterGauge("connections", gauge2, "count"))
+	reg1.Unregister("connections")
+	r.Equal("7", reg2.m.Get("connections").String())
+
+	reg2.Unregister("connections")
+	r.Nil(reg2.m.Get("connections"))
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	gauge := NewGauge()
+	r.NoError(reg.RegisterGauge("connections", gauge, "count"))
+	r.Equal(1, testutil.CollectAndCount(preg))
+	r.NotNil(reg.m.Get("connections"))
+
+	reg.Unregister("connections")
+	r.Equal(0, testutil.CollectAndCount(preg))
+	r.Nil(reg.m.Get("connections"))
+	r.Nil(reg.GetMetricsRegistry().Get(".connections"))
+
+	r.NoError(reg.RegisterGauge("connections", NewGauge(), "count"))
+
+	// durations of a re-registered timer are observed once
+	timer := NewTimer()
+	r.NoError(reg.RegisterTimer("query", timer, AsHistogram([]float64{1})))
+	reg.Unregister("query")
+	r.NoError(reg.RegisterTimer("query", timer, AsHistogram([]float64{1})))
+	timer.Update(time.Second)
+
+	r.NoError(testutil.CollectAndCompare(reg.collectors["query"], strings.NewReader(`
+# HELP test_query_seconds query
+# TYPE test_query_seconds histogram
+test_query_seconds_bucket{le="1"} 1
+test_query_seconds_bucket{le="+Inf"} 1
+test_query_seconds_sum 1
+test_query_seconds_count 1
+`)))
+}
+
+func TestCreateSubRegistry(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+	sub := reg.CreateSubRegistry("db")
+
+	timer := NewTimer()
+	r.NoError(sub.RegisterTimer("query", timer))
+	timer.Time(func() {})
+
+	count, err := testutil.GatherAndCount(preg, "test_db_query_seconds")
+	r.NoError(err)
+	r.Equal(1, count)
+}
+
+func TestTimerOutcomes(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	timer := NewTimer()
+	r.NoError(reg.RegisterTimer("call", timer))
+
+	r.NoError(timer.TimeErr(func() error { return nil }))
+	r.Error(timer.TimeErr(func() error { return errors.New("failed") }))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	r.Error(timer.TimeCtx(ctx, func(ctx context.Context) error { return ctx.Err() }))
+
+	stop := timer.StartOutcome()
+	stop("custom")
+	timer.Start()()
+
+	r.Equal(int64(5), timer.t.Count())
+	r.Equal(4, testutil.CollectAndCount(preg, "test_call_outcome_seconds"))
+	for _, outcome := range []string{OutcomeOK, OutcomeError, OutcomeTimeout, "custom"} {
+		r.Equal(int64(1), timer.outcomes.tv.WithLabelValues(outcome).t.Count())
+	}
+
+	reg.Unregister("call")
+	r.Equal(0, testutil.CollectAndCount(preg))
+}
+
+func TestTimerWithoutOutcomes(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	// the outcome name of a timer must be free
+	r.NoError(reg.RegisterGauge("call_outcome", NewGauge(), "count"))
+	r.Error(reg.RegisterTimer("call", NewTimer()))
+	reg.Unregister("call_outcome")
+
+	timer := NewTimer()
+	r.NoError(reg.RegisterTimer("call", timer))
+	timer.Time(func() {})
+
+	r.Equal(1, testutil.CollectAndCount(preg, "test_call_seconds"))
+	r.Equal(0, testutil.CollectAndCount(preg, "test_call_outcome_seconds"))
+	r.Nil(reg.GetMetricsRegistry().Get(".call_outcome.ok"))
+
+	// outcomes are not exported when the name is taken once they are recorded, the error is logged
+	core, logs := observer.New(zapcore.WarnLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	r.NoError(reg.RegisterGauge("call_outcome", NewGauge(), "count"))
+	r.NoError(timer.TimeErr(func() error { return nil }))
+	r.Equal(0, testutil.CollectAndCount(preg, "test_call_outcome_seconds"))
+	r.Equal(1, logs.FilterField(zap.String("name", "call_outcome")).Len())
+
+	reg.Unregister("call")
+	r.Equal(1, testutil.CollectAndCount(preg))
+}
+
+func TestTimerVecOutcomes(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	tv := NewTimerVec(VecOpts{LabelNames: []string{"path"}})
+	r.NoError(reg.RegisterTimerVec("latency", tv))
+
+	tv.WithLabelValues("/a").Time(func() {})
+	r.Equal(0, testutil.CollectAndCount(preg, "test_latency_outcome_seconds"))
+
+	r.Error(tv.WithLabelValues("/a").TimeErr(func() error { return errors.New("failed") }))
+	r.NoError(tv.WithLabelValues("/b").TimeErr(func() error { return nil }))
+
+	r.Equal(2, testutil.CollectAndCount(preg, "test_latency_outcome_seconds"))
+	r.Equal(int64(1), tv.outcomes.tv.WithLabelValues("/a", OutcomeError).t.Count())
+	r.NotNil(reg.GetMetricsRegistry().Get(".latency_outcome./b.ok"))
+
+	reg.Unregister("latency")
+	r.Equal(0, testutil.CollectAndCount(preg))
+}
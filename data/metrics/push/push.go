@@ -0,0 +1,343 @@
+// Package push periodically pushes metrics of metrics.Registry to StatsD or Graphite.
+// It's intended for services which don't expose HTTP port that Prometheus could scrape.
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mthmetrics "github.com/monetha/mth-core/data/metrics"
+	"github.com/rcrowley/go-metrics"
+	"go.uber.org/zap"
+)
+
+// Protocol is the protocol metrics are pushed with.
+type Protocol int
+
+const (
+	// StatsD pushes metrics over UDP in StatsD format, tags are sent in DogStatsD format.
+	StatsD Protocol = iota
+	// Graphite pushes metrics over TCP in Graphite plaintext format, tags are sent as Graphite tags.
+	Graphite
+)
+
+const (
+	defaultInterval      = 10 * time.Second
+	defaultDialTimeout   = 5 * time.Second
+	defaultMaxPacketSize = 1432 // fits into Ethernet MTU together with IP and UDP headers
+)
+
+var percentiles = []struct {
+	suffix string
+	perc   float64
+}{
+	{"p50", 0.5},
+	{"p75", 0.75},
+	{"p95", 0.95},
+	{"p99", 0.99},
+	{"p999", 0.999},
+}
+
+// Config is the Exporter configuration.
+type Config struct {
+	// Registry is the registry metrics are pushed from.
+	Registry *mthmetrics.Registry
+
+	// Protocol is the protocol metrics are pushed with. Default to StatsD.
+	Protocol Protocol
+
+	// Address is the host:port of StatsD or Graphite server.
+	Address string
+
+	// Interval is a regular interval for pushing metrics. Default to 10s.
+	Interval time.Duration
+
+	// Prefix is prepended to all metric names.
+	Prefix string
+
+	// Tags are added to all metrics.
+	Tags map[string]string
+
+	// MaxPacketSize is the maximum size of StatsD UDP packet. Default to 1432 bytes.
+	MaxPacketSize int
+
+	// Logger is the logger used. Default to zap.L().
+	Logger *zap.Logger
+}
+
+// defaults for configuration
+func (c *Config) defaults() {
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultInterval
+	}
+	if c.MaxPacketSize == 0 {
+		c.MaxPacketSize = defaultMaxPacketSize
+	}
+	if c.Registry == nil {
+		panic("push: Registry must be set")
+	}
+	if len(c.Address) == 0 {
+		panic("push: Address length must be at least 1")
+	}
+}
+
+// Exporter pushes metrics periodically.
+type Exporter struct {
+	*Config
+	tags string
+	conn net.Conn
+	// lastCounts holds counts pushed successfully last time, StatsD counters are sent as deltas.
+	lastCounts map[string]int64
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// New creates new exporter with the given config.
+func New(config *Config) *Exporter {
+	config.defaults()
+	return &Exporter{
+		Config:     config,
+		tags:       formatTags(config.Protocol, config.Tags),
+		lastCounts: make(map[string]int64),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Start the exporter. Calls after the first one are ignored.
+func (e *Exporter) Start() {
+	if !e.started.CompareAndSwap(false, true) {
+		return
+	}
+	e.Logger.With(zap.String("address", e.Address)).Info("starting metrics exporter")
+	go e.loop()
+}
+
+// Stop the exporter gracefully. Pushes metrics once more before returning, when the exporter was started.
+func (e *Exporter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.done)
+		if e.started.Load() {
+			<-e.stopped
+		}
+	})
+}
+
+func (e *Exporter) loop() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush(time.Now())
+		case <-e.done:
+			e.flush(time.Now())
+			if e.conn != nil {
+				e.conn.Close()
+			}
+			e.Logger.Info("metrics exporter stopped")
+			return
+		}
+	}
+}
+
+// flush pushes snapshot of all registry metrics.
+func (e *Exporter) flush(now time.Time) {
+	lines := e.collect(now)
+	if len(lines) == 0 {
+		return
+	}
+
+	if err := e.send(lines); err != nil {
+		e.Logger.With(zap.Error(err)).Warn("push metrics")
+		if e.conn != nil {
+			e.conn.Close()
+			e.conn = nil
+		}
+	}
+}
+
+// line is a formatted line of a metric. Lines of StatsD counters carry the count sent as delta,
+// which is committed to lastCounts once the line is sent.
+type line struct {
+	text    string
+	counter string // counter name, empty for other lines
+	count   int64
+}
+
+// send sends the lines, counts of StatsD counters are committed once their packets are written,
+// so deltas of failed packets are sent with the next flush.
+func (e *Exporter) send(lines []line) error {
+	if e.conn == nil {
+		network := "udp"
+		if e.Protocol == Graphite {
+			network = "tcp"
+		}
+		conn, err := net.DialTimeout(network, e.Address, defaultDialTimeout)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+
+	var (
+		buf     bytes.Buffer
+		pending []line
+	)
+	write := func() error {
+		if _, err := e.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		for _, l := range pending {
+			e.lastCounts[l.counter] = l.count
+		}
+		buf.Reset()
+		pending = pending[:0]
+		return nil
+	}
+
+	for _, l := range lines {
+		// StatsD lines are split into packets not exceeding the max packet size
+		if e.Protocol == StatsD && buf.Len() > 0 && buf.Len()+len(l.text) > e.MaxPacketSize {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(l.text)
+		if l.counter != "" {
+			pending = append(pending, l)
+		}
+	}
+	return write()
+}
+
+// collect formats lines of all registry metrics.
+func (e *Exporter) collect(now time.Time) (lines []line) {
+	ts := now.Unix()
+
+	counter := func(name string, count int64) {
+		if e.Protocol == Graphite {
+			lines = append(lines, line{text: e.graphiteLine(name, strconv.FormatInt(count, 10), ts)})
+			return
+		}
+		delta := count - e.lastCounts[name]
+		if delta < 0 {
+			// the counter was reset, e.g. the metric was registered again, so it counts from zero
+			delta = count
+		}
+		lines = append(lines, line{text: e.statsdLine(name, strconv.FormatInt(delta, 10), "c"), counter: name, count: count})
+	}
+	gauge := func(name string, v float64) {
+		value := strconv.FormatFloat(v, 'f', -1, 64)
+		if e.Protocol == Graphite {
+			lines = append(lines, line{text: e.graphiteLine(name, value, ts)})
+			return
+		}
+		lines = append(lines, line{text: e.statsdLine(name, value, "g")})
+	}
+	distribution := func(name string, count, min, max int64, mean float64, ps []float64, scale float64) {
+		counter(name+".count", count)
+		gauge(name+".min", float64(min)/scale)
+		gauge(name+".max", float64(max)/scale)
+		gauge(name+".mean", mean/scale)
+		for i, p := range percentiles {
+			gauge(name+"."+p.suffix, ps[i]/scale)
+		}
+	}
+
+	perc := make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		perc[i] = p.perc
+	}
+
+	e.Registry.GetMetricsRegistry().Each(func(name string, i interface{}) {
+		name = e.metricName(name)
+		switch m := i.(type) {
+		case metrics.Meter:
+			s := m.Snapshot()
+			counter(name+".count", s.Count())
+			gauge(name+".one-minute", s.Rate1())
+		case metrics.Gauge:
+			gauge(name, float64(m.Snapshot().Value()))
+		case metrics.Timer:
+			s := m.Snapshot()
+			// timer values are pushed in milliseconds
+			distribution(name, s.Count(), s.Min(), s.Max(), s.Mean(), s.Percentiles(perc), float64(time.Millisecond))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			distribution(name, s.Count(), s.Min(), s.Max(), s.Mean(), s.Percentiles(perc), 1)
+		}
+	})
+
+	return
+}
+
+func (e *Exporter) metricName(name string) string {
+	name = strings.Trim(sanitize(name), ".")
+	if e.Prefix != "" {
+		name = strings.TrimSuffix(e.Prefix, ".") + "." + name
+	}
+	return name
+}
+
+func (e *Exporter) statsdLine(name, value, typ string) string {
+	return name + ":" + value + "|" + typ + e.tags + "\n"
+}
+
+func (e *Exporter) graphiteLine(name, value string, ts int64) string {
+	return name + e.tags + " " + value + " " + strconv.FormatInt(ts, 10) + "\n"
+}
+
+// formatTags formats tags in DogStatsD or Graphite format, sorted by tag name.
+func formatTags(p Protocol, tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for i, k := range keys {
+		switch {
+		case p == Graphite:
+			fmt.Fprintf(&sb, ";%s=%s", sanitize(k), sanitize(tags[k]))
+		case i == 0:
+			fmt.Fprintf(&sb, "|#%s:%s", sanitize(k), sanitize(tags[k]))
+		default:
+			fmt.Fprintf(&sb, ",%s:%s", sanitize(k), sanitize(tags[k]))
+		}
+	}
+	return sb.String()
+}
+
+// sanitize replaces characters having special meaning in StatsD and Graphite formats.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ':', '|', '@', '#', ';', '=', ',', '\n':
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+}
@@ -0,0 +1,183 @@
+package push
+
+import (
+	"bufio"
+	"errors"
+	"expvar"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	mthmetrics "github.com/monetha/mth-core/data/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry(t *testing.T) (*mthmetrics.Registry, *mthmetrics.Rate, *mthmetrics.Gauge) {
+	registry := mthmetrics.NewRegistry("svc", mthmetrics.WithRegisterer(prometheus.NewRegistry()),
+		mthmetrics.WithExpvarRoot(new(expvar.Map).Init()))
+
+	rate := mthmetrics.NewRate()
+	require.NoError(t, registry.RegisterRate("jobs", rate))
+	gauge := mthmetrics.NewGauge()
+	require.NoError(t, registry.RegisterGauge("queue", gauge, "count"))
+	timer := mthmetrics.NewTimer()
+	require.NoError(t, registry.RegisterTimer("job time", timer))
+	timer.Update(20 * time.Millisecond)
+
+	return registry, rate, gauge
+}
+
+func TestExporterStatsD(t *testing.T) {
+	r := require.New(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	r.NoError(err)
+	defer pc.Close()
+
+	registry, rate, gauge := newTestRegistry(t)
+	rate.Mark(5)
+	gauge.Update(7)
+
+	e := New(&Config{
+		Registry: registry,
+		Address:  pc.LocalAddr().String(),
+		Interval: time.Hour,
+		Prefix:   "prefix",
+		Tags:     map[string]string{"env": "test", "app": "svc"},
+	})
+	e.Start()
+
+	// the second flush sends counter delta
+	e.flush(time.Now())
+	rate.Mark(2)
+	e.Stop()
+
+	var received []string
+	buf := make([]byte, 65536)
+	r.NoError(pc.SetReadDeadline(time.Now().Add(time.Second)))
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		received = append(received, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+	}
+
+	r.Contains(received, "prefix.svc.jobs.count:5|c|#app:svc,env:test")
+	r.Contains(received, "prefix.svc.jobs.count:2|c|#app:svc,env:test")
+	r.Contains(received, "prefix.svc.queue:7|g|#app:svc,env:test")
+	r.Contains(received, "prefix.svc.job_time.max:20|g|#app:svc,env:test")
+}
+
+// failingConn fails all writes.
+type failingConn struct {
+	net.Conn
+}
+
+func (failingConn) Write([]byte) (int, error) { return 0, errors.New("connection refused") }
+func (failingConn) Close() error              { return nil }
+
+// readLines reads lines of StatsD packets until no packet is received for a while.
+func readLines(t *testing.T, pc net.PacketConn) (lines []string) {
+	buf := make([]byte, 65536)
+	for {
+		require.NoError(t, pc.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+	}
+}
+
+func TestExporterStatsDRetriesCounts(t *testing.T) {
+	r := require.New(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	r.NoError(err)
+	defer pc.Close()
+
+	registry, rate, _ := newTestRegistry(t)
+	rate.Mark(5)
+
+	e := New(&Config{Registry: registry, Address: pc.LocalAddr().String(), Interval: time.Hour})
+	defer func() {
+		if e.conn != nil {
+			e.conn.Close()
+		}
+	}()
+
+	// the delta of the failed send is sent with the next flush
+	e.conn = failingConn{}
+	e.flush(time.Now())
+	r.Nil(e.conn)
+
+	e.flush(time.Now())
+	r.Contains(readLines(t, pc), "svc.jobs.count:5|c")
+
+	// a counter going down was reset, so it's sent as is
+	e.lastCounts["svc.jobs.count"] = 8
+	rate.Mark(1)
+	e.flush(time.Now())
+	r.Contains(readLines(t, pc), "svc.jobs.count:6|c")
+}
+
+func TestExporterGraphite(t *testing.T) {
+	r := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	defer l.Close()
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+
+	registry, rate, _ := newTestRegistry(t)
+	rate.Mark(3)
+
+	e := New(&Config{
+		Registry: registry,
+		Protocol: Graphite,
+		Address:  l.Addr().String(),
+		Interval: time.Hour,
+		Tags:     map[string]string{"env": "test"},
+	})
+	e.Start()
+	e.Stop()
+
+	var received []string
+	for line := range lines {
+		received = append(received, line[:strings.LastIndexByte(line, ' ')])
+	}
+
+	r.Contains(received, "svc.jobs.count;env=test 3")
+	r.Contains(received, "svc.queue;env=test 0")
+}
+
+func TestExporterStartStop(t *testing.T) {
+	registry, _, _ := newTestRegistry(t)
+
+	// stopping an exporter which wasn't started returns immediately
+	e := New(&Config{Registry: registry, Address: "127.0.0.1:8125", Interval: time.Hour})
+	e.Stop()
+
+	// repeated calls are ignored
+	e = New(&Config{Registry: registry, Address: "127.0.0.1:8125", Interval: time.Hour})
+	e.Start()
+	e.Start()
+	e.Stop()
+	e.Stop()
+}
@@ -0,0 +1,347 @@
+package metrics
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// DefaultMaxCardinality is the default maximum number of label combinations tracked by a vector.
+	DefaultMaxCardinality = 1000
+
+	// OverflowLabelValue is the label value used for all labels of observations
+	// that exceed the cardinality limit of a vector.
+	OverflowLabelValue = "_overflow_"
+)
+
+// VecOpts are the options of labelled metric vectors.
+type VecOpts struct {
+	// LabelNames are the names of labels, label values are passed in the same order on observation.
+	LabelNames []string
+
+	// MaxCardinality limits the number of label combinations tracked by the vector.
+	// Observations with new label combinations above the limit are recorded
+	// with all labels set to OverflowLabelValue. Defaults to DefaultMaxCardinality.
+	MaxCardinality int
+}
+
+type vecHook[T any] func(lvs []string, child T)
+
+// vec holds children metrics of a vector by label values.
+type vec[T any] struct {
+	labelNames     []string
+	maxCardinality int
+	newChild       func(lvs []string) T
+
+	mu       sync.Mutex
+	children map[string]T
+	labels   map[string][]string
+	hooks    map[int]vecHook[T]
+	nextHook int
+}
+
+func newVec[T any](opts VecOpts, newChild func(lvs []string) T) *vec[T] {
+	if len(opts.LabelNames) == 0 {
+		panic("expected non empty label names")
+	}
+	maxCardinality := opts.MaxCardinality
+	if maxCardinality <= 0 {
+		maxCardinality = DefaultMaxCardinality
+	}
+	return &vec[T]{
+		labelNames:     append([]string(nil), opts.LabelNames...),
+		maxCardinality: maxCardinality,
+		newChild:       newChild,
+		children:       make(map[string]T),
+		labels:         make(map[string][]string),
+		hooks:          make(map[int]vecHook[T]),
+	}
+}
+
+// get returns the child for the given label values, creating it if needed.
+func (v *vec[T]) get(lvs []string) T {
+	if len(lvs) != len(v.labelNames) {
+		panic("inconsistent label cardinality: expected " + strings.Join(v.labelNames, ", "))
+	}
+
+	key := strings.Join(lvs, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+
+	if len(v.children) >= v.maxCardinality {
+		lvs = make([]string, len(v.labelNames))
+		for i := range lvs {
+			lvs[i] = OverflowLabelValue
+		}
+		key = strings.Join(lvs, "\xff")
+		if child, ok := v.children[key]; ok {
+			return child
+		}
+	} else {
+		lvs = append([]string(nil), lvs...)
+	}
+
+	child := v.newChild(lvs)
+	v.children[key] = child
+	v.labels[key] = lvs
+	for _, hook := range v.hooks {
+		hook(lvs, child)
+	}
+
+	return child
+}
+
+// addHook adds the hook called on every child creation. The hook is called for
+// already existing children before addHook returns, holding the vector lock
+// while adding it, so no child is missed by the hook or hooked twice.
+// Returned function removes the hook.
+func (v *vec[T]) addHook(hook vecHook[T]) (remove func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	id := v.nextHook
+	v.nextHook++
+	v.hooks[id] = hook
+
+	for key, child := range v.children {
+		hook(v.labels[key], child)
+	}
+
+	return func() {
+		v.mu.Lock()
+		delete(v.hooks, id)
+		v.mu.Unlock()
+	}
+}
+
+// each calls f for every child of the vector.
+func (v *vec[T]) each(f func(lvs []string, child T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for key, child := range v.children {
+		f(v.labels[key], child)
+	}
+}
+
+// RateVec is a Rate partitioned by label values.
+type RateVec struct {
+	v *vec[*Rate]
+}
+
+// NewRateVec creates a new RateVec with the given options.
+func NewRateVec(opts VecOpts) *RateVec {
+	return &RateVec{newVec(opts, func([]string) *Rate { return NewRate() })}
+}
+
+// WithLabelValues returns the Rate for the given label values.
+func (rv *RateVec) WithLabelValues(lvs ...string) *Rate {
+	return rv.v.get(lvs)
+}
+
+// TimerVec is a Timer partitioned by label values.
+type TimerVec struct {
+	v        *vec[*Timer]
+	outcomes *timerOutcomes // outcomes of the children
+}
+
+// NewTimerVec creates a new TimerVec with the given options.
+func NewTimerVec(opts VecOpts) *TimerVec {
+	tv := &TimerVec{}
+	tv.v = newVec(opts, func(lvs []string) *Timer {
+		timer := newTimer()
+		timer.outcomes, timer.lvs = tv.outcomes, lvs
+		return timer
+	})
+	tv.outcomes = newTimerOutcomes(tv.v.labelNames, tv.v.maxCardinality)
+	return tv
+}
+
+// WithLabelValues returns the Timer for the given label values.
+func (tv *TimerVec) WithLabelValues(lvs ...string) *Timer {
+	return tv.v.get(lvs)
+}
+
+// GaugeVec is a Gauge partitioned by label values.
+type GaugeVec struct {
+	v *vec[*Gauge]
+}
+
+// NewGaugeVec creates a new GaugeVec with the given options.
+func NewGaugeVec(opts VecOpts) *GaugeVec {
+	return &GaugeVec{newVec(opts, func([]string) *Gauge { return NewGauge() })}
+}
+
+// WithLabelValues returns the Gauge for the given label values.
+func (gv *GaugeVec) WithLabelValues(lvs ...string) *Gauge {
+	return gv.v.get(lvs)
+}
+
+// HistogramVec is a Histogram partitioned by label values.
+type HistogramVec struct {
+	v *vec[*Histogram]
+}
+
+// NewHistogramVec creates a new HistogramVec with the given options.
+func NewHistogramVec(opts VecOpts) *HistogramVec {
+	return &HistogramVec{newVec(opts, func([]string) *Histogram { return NewHistogram() })}
+}
+
+// WithLabelValues returns the Histogram for the given label values.
+func (hv *HistogramVec) WithLabelValues(lvs ...string) *Histogram {
+	return hv.v.get(lvs)
+}
+
+// RegisterRateVec registers a new rate vector under the given name or returns an error
+func (r *Registry) RegisterRateVec(name string, rv *RateVec) error {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: r.pName,
+		Name:      toPrometheusName(name + "_total"),
+		Help:      name,
+	}, rv.v.labelNames)
+
+	return registerVec(r, name, counter, rv.v, func(counter *prometheus.CounterVec, lvs []string, rate *Rate) (metrics.Meter, func()) {
+		c := counter.WithLabelValues(lvs...)
+		return rate.m, rate.registerMarkCallback(func(v int64) {
+			c.Add(float64(v))
+		})
+	}, rateVar)
+}
+
+// RegisterTimerVec registers a new timer vector under the given name or returns an error.
+// By default the timers are exported to Prometheus as Summary, see ExportOption for alternatives.
+// Outcomes of the timers are exported under the name with "_outcome" suffix once recorded (see Timer.UpdateOutcome),
+// the name must be free.
+func (r *Registry) RegisterTimerVec(name string, tv *TimerVec, opts ...ExportOption) error {
+	if err := r.checkName(name + "_outcome"); err != nil {
+		return err
+	}
+
+	observer := newExportOptions(opts).newObserverVec(r.pName, toPrometheusName(name+"_seconds"), name, tv.v.labelNames)
+
+	err := registerVec(r, name, observer, tv.v, func(observer prometheus.ObserverVec, lvs []string, timer *Timer) (metrics.Timer, func()) {
+		o := observer.WithLabelValues(lvs...)
+		return timer.t, timer.registerTimeCallback(func(duration time.Duration) {
+			o.Observe(duration.Seconds())
+		})
+	}, timerVar)
+	if err != nil {
+		return err
+	}
+
+	r.addCleanup(name, r.registerOutcomes(name, tv.outcomes, opts))
+	return nil
+}
+
+// RegisterGaugeVec registers a new gauge vector under the given name or returns an error
+func (r *Registry) RegisterGaugeVec(name string, gv *GaugeVec, units string) error {
+	if len(units) == 0 {
+		panic("expected non empty units")
+	}
+
+	pgauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: r.pName,
+		Name:      toPrometheusName(name + "_" + units),
+		Help:      name,
+	}, gv.v.labelNames)
+
+	return registerVec(r, name, pgauge, gv.v, func(pgauge *prometheus.GaugeVec, lvs []string, gauge *Gauge) (metrics.Gauge, func()) {
+		g := pgauge.WithLabelValues(lvs...)
+		return gauge.g, gauge.registerUpdateCallback(func(v int64) {
+			g.Set(float64(v))
+		})
+	}, gaugeVar)
+}
+
+// RegisterHistogramVec registers a new histogram vector under the given name or returns an error.
+// By default the histograms are exported to Prometheus as Summary, see ExportOption for alternatives.
+func (r *Registry) RegisterHistogramVec(name string, hv *HistogramVec, units string, opts ...ExportOption) error {
+	if len(units) == 0 {
+		panic("expected non empty units")
+	}
+
+	observer := newExportOptions(opts).newObserverVec(r.pName, toPrometheusName(name+"_"+units), name, hv.v.labelNames)
+
+	return registerVec(r, name, observer, hv.v, func(observer prometheus.ObserverVec, lvs []string, histogram *Histogram) (metrics.Histogram, func()) {
+		o := observer.WithLabelValues(lvs...)
+		return histogram.h, histogram.registerUpdateCallback(func(v int64) {
+			o.Observe(float64(v))
+		})
+	}, histogramVar)
+}
+
+// registerVec registers the vector collector and hooks every child of the vector to it, hookChild
+// returns the go-metrics metric of the child and the function removing callbacks it added to the child.
+// In expvar each label combination becomes a nested map, in go-metrics registry children
+// are registered under the vector name followed by label values.
+func registerVec[T any, C prometheus.Collector, M any](r *Registry, name string, c C, v *vec[T],
+	hookChild func(c C, lvs []string, child T) (M, func()), childVar func(T) expvar.Var) error {
+
+	// the name is reserved before registering the collector, so concurrent registrations can't both succeed
+	r.mu.Lock()
+	_, duplicate := r.collectors[name]
+	duplicate = duplicate || r.r.Get("."+name) != nil
+	if !duplicate {
+		r.collectors[name] = nil
+	}
+	r.mu.Unlock()
+	if duplicate {
+		return metrics.DuplicateMetric(name)
+	}
+
+	c, err := registerCollector(r, name, c)
+	if err != nil {
+		r.mu.Lock()
+		delete(r.collectors, name)
+		r.mu.Unlock()
+		return err
+	}
+
+	node := new(expvar.Map).Init()
+	r.setVar(name, node)
+
+	// removeChildren is guarded by the vector lock, hooks are called holding it
+	var removeChildren []func()
+	removeHook := v.addHook(func(lvs []string, child T) {
+		m, remove := hookChild(c, lvs, child)
+		removeChildren = append(removeChildren, remove)
+		setNestedVar(node, lvs, childVar(child))
+		_ = r.r.Register(childMetricName(name, lvs), m)
+	})
+
+	r.addCleanup(name, func() {
+		removeHook()
+		v.each(func(lvs []string, _ T) {
+			r.r.Unregister(childMetricName(name, lvs))
+		})
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		for _, remove := range removeChildren {
+			remove()
+		}
+	})
+
+	return nil
+}
+
+func childMetricName(name string, lvs []string) string {
+	return "." + name + "." + strings.Join(lvs, ".")
+}
+
+// setNestedVar sets the variable in the map nested by the label values.
+func setNestedVar(m *expvar.Map, lvs []string, v expvar.Var) {
+	for _, lv := range lvs[:len(lvs)-1] {
+		m = childExpvarMap(m, lv)
+	}
+	m.Set(lvs[len(lvs)-1], v)
+}
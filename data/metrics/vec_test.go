@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateVec(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	rv := NewRateVec(VecOpts{LabelNames: []string{"method", "status"}})
+	rv.WithLabelValues("GET", "2xx").Mark(1)
+
+	r.NoError(reg.RegisterRateVec("requests", rv))
+	r.Error(reg.RegisterRateVec("requests", NewRateVec(VecOpts{LabelNames: []string{"method"}})))
+
+	rv.WithLabelValues("GET", "2xx").Mark(1)
+	rv.WithLabelValues("POST", "5xx").Mark(3)
+
+	r.Equal(2, testutil.CollectAndCount(preg, "test_requests_total"))
+
+	var v map[string]map[string]map[string]interface{}
+	r.NoError(json.Unmarshal([]byte(reg.m.Get("requests").String()), &v))
+	r.Contains(v["GET"], "2xx")
+	r.Contains(v["POST"], "5xx")
+	r.NotNil(reg.GetMetricsRegistry().Get(".requests.POST.5xx"))
+
+	reg.Unregister("requests")
+	r.Equal(0, testutil.CollectAndCount(preg))
+	r.Nil(reg.GetMetricsRegistry().Get(".requests.POST.5xx"))
+}
+
+func TestVecConcurrentRegistration(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+	rv := NewRateVec(VecOpts{LabelNames: []string{"id"}})
+
+	const n = 50
+	var wg sync.WaitGroup
+	mark := func() {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rv.WithLabelValues(strconv.Itoa(i)).Mark(1)
+			}(i)
+		}
+	}
+
+	mark()
+	r.NoError(reg.RegisterRateVec("requests", rv))
+	wg.Wait()
+	r.Equal(n, testutil.CollectAndCount(preg, "test_requests_total"))
+
+	mark()
+	reg.Unregister("requests")
+	wg.Wait()
+	r.Equal(0, testutil.CollectAndCount(preg))
+
+	// callbacks of the registration are removed from children
+	rv.v.each(func(_ []string, rate *Rate) {
+		r.Len(rate.cs.load(), 1)
+	})
+}
+
+func TestVecMaxCardinality(t *testing.T) {
+	r := require.New(t)
+
+	reg, preg := newTestRegistry("test")
+
+	tv := NewTimerVec(VecOpts{LabelNames: []string{"path"}, MaxCardinality: 2})
+	r.NoError(reg.RegisterTimerVec("latency", tv))
+
+	a := tv.WithLabelValues("/a")
+	r.Same(a, tv.WithLabelValues("/a"))
+	tv.WithLabelValues("/b")
+	overflow := tv.WithLabelValues("/c")
+	r.Same(overflow, tv.WithLabelValues("/d"))
+	r.Same(overflow, tv.WithLabelValues(OverflowLabelValue))
+
+	r.Equal(3, testutil.CollectAndCount(preg, "test_latency_seconds"))
+}
+
+func TestVecInconsistentLabels(t *testing.T) {
+	gv := NewGaugeVec(VecOpts{LabelNames: []string{"a", "b"}})
+	require.Panics(t, func() {
+		gv.WithLabelValues("x")
+	})
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/monetha/mth-core/db/pqtimeouts" // registers pq-timeouts driver
+	"go.uber.org/zap"
+)
+
+// Balancer selects the replica serving reads.
+type Balancer int
+
+const (
+	// RoundRobin spreads reads over healthy replicas evenly.
+	RoundRobin Balancer = iota
+	// LeastLatency sends reads to the healthy replica with the lowest health check latency.
+	LeastLatency
+)
+
+const (
+	defaultClusterHealthCheckInterval = 5 * time.Second
+	defaultStickiness                 = 5 * time.Second
+
+	// latencySmoothing is the weight of the last latency in the moving average of replica latencies.
+	latencySmoothing = 0.3
+)
+
+// ClusterConfig is the Cluster configuration.
+type ClusterConfig struct {
+	// Balancer selects the replica serving reads. Default to RoundRobin.
+	Balancer Balancer
+
+	// HealthCheckInterval is a regular interval for checking health of replicas. Default to 5s.
+	HealthCheckInterval time.Duration
+
+	// HealthCheck configures replica health checks, e.g. MaxReplicationLag ejects lagging replicas.
+	HealthCheck HealthCheckerConfig
+
+	// Stickiness is how long reads of a read-your-writes context go to the primary after a write. Default to 5s.
+	Stickiness time.Duration
+
+	// Logger is the logger used. Default to zap.L().
+	Logger *zap.Logger
+}
+
+// defaults for configuration
+func (c *ClusterConfig) defaults() {
+	if c.HealthCheckInterval == 0 {
+		c.HealthCheckInterval = defaultClusterHealthCheckInterval
+	}
+	if c.Stickiness == 0 {
+		c.Stickiness = defaultStickiness
+	}
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+}
+
+// replica is a replica database of the cluster.
+type replica struct {
+	index   int
+	db      *sql.DB
+	checker *HealthChecker
+	healthy atomic.Bool
+	latency atomic.Int64 // moving average of health check latencies in nanoseconds
+}
+
+// Cluster routes queries to the primary database and its read replicas. Writes go to the primary,
+// reads go to a healthy replica selected by the balancer, or to the primary when no replica is healthy.
+// Replicas are health checked regularly once the cluster is started, failing replicas are ejected
+// until they're healthy again.
+type Cluster struct {
+	config   ClusterConfig
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64 // round-robin counter
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewCluster creates a cluster of the primary and replica databases. Replicas are considered healthy
+// until the first health check.
+func NewCluster(primary *sql.DB, replicas []*sql.DB, config ClusterConfig) *Cluster {
+	config.defaults()
+
+	c := &Cluster{
+		config:  config,
+		primary: primary,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for i, db := range replicas {
+		r := &replica{index: i, db: db, checker: NewHealthChecker(db, config.HealthCheck)}
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, r)
+	}
+	return c
+}
+
+// OpenCluster opens the primary and replica databases with the pq-timeouts driver and creates a cluster.
+func OpenCluster(primaryDSN string, replicaDSNs []string, config ClusterConfig) (*Cluster, error) {
+	primary, err := sql.Open("pq-timeouts", primaryDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*sql.DB, 0, len(replicaDSNs))
+	for i, dsn := range replicaDSNs {
+		db, err := sql.Open("pq-timeouts", dsn)
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		replicas = append(replicas, db)
+	}
+
+	return NewCluster(primary, replicas, config), nil
+}
+
+// Start checks health of replicas and keeps checking it regularly until the cluster is closed.
+// Calls after the first one are ignored.
+func (c *Cluster) Start() {
+	if !c.started.CompareAndSwap(false, true) {
+		return
+	}
+	c.checkReplicas()
+	go c.loop()
+}
+
+// Close stops health checks and closes all databases.
+func (c *Cluster) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.done)
+		if c.started.Load() {
+			<-c.stopped
+		}
+	})
+
+	err := c.primary.Close()
+	for _, r := range c.replicas {
+		if rerr := r.db.Close(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (c *Cluster) loop() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkReplicas()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// checkReplicas checks health of all replicas concurrently.
+func (c *Cluster) checkReplicas() {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			c.checkReplica(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) checkReplica(r *replica) {
+	start := time.Now()
+	err := r.checker.CheckHealth()
+	latency := time.Since(start)
+
+	if err == nil {
+		if prev := r.latency.Load(); prev != 0 {
+			latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(prev))
+		}
+		r.latency.Store(int64(latency))
+	}
+
+	l := c.config.Logger.With(zap.Int("replica", r.index))
+	switch healthy := err == nil; {
+	case !healthy && r.healthy.Swap(false):
+		l.With(zap.Error(err)).Warn("replica ejected")
+	case healthy && !r.healthy.Swap(true):
+		l.Info("replica restored")
+	}
+}
+
+// Primary returns the primary database, e.g. for reads which must see the latest writes.
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Replica returns the database serving reads of the context: a healthy replica selected by the balancer,
+// or the primary when no replica is healthy or the context saw a recent write (see WithReadYourWrites).
+func (c *Cluster) Replica(ctx context.Context) *sql.DB {
+	if s, ok := ctx.Value(contextKeyStickiness).(*stickiness); ok && s.sticky(c.config.Stickiness) {
+		return c.primary
+	}
+
+	switch c.config.Balancer {
+	case LeastLatency:
+		var best *replica
+		for _, r := range c.replicas {
+			if r.healthy.Load() && (best == nil || r.latency.Load() < best.latency.Load()) {
+				best = r
+			}
+		}
+		if best != nil {
+			return best.db
+		}
+	default:
+		n := uint64(len(c.replicas))
+		start := c.next.Add(1)
+		for i := uint64(0); i < n; i++ {
+			if r := c.replicas[(start+i)%n]; r.healthy.Load() {
+				return r.db
+			}
+		}
+	}
+
+	return c.primary
+}
+
+// QueryContext executes a query returning rows on a replica, see Replica.
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.Replica(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext executes a query returning a single row on a replica, see Replica.
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.Replica(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext executes a query without returning rows on the primary.
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := c.primary.ExecContext(ctx, query, args...)
+	MarkWrite(ctx)
+	return res, err
+}
+
+// InTx runs f in a transaction of the primary, see InTx.
+func (c *Cluster) InTx(ctx context.Context, opts *TxOptions, f func(tx *sql.Tx) error) error {
+	err := InTx(ctx, c.primary, opts, f)
+	MarkWrite(ctx)
+	return err
+}
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type stickinessContextKey int
+
+const contextKeyStickiness stickinessContextKey = iota
+
+// stickiness is the time of the last write of a read-your-writes context.
+type stickiness struct {
+	lastWrite atomic.Int64 // unix nanoseconds
+}
+
+func (s *stickiness) sticky(d time.Duration) bool {
+	lastWrite := s.lastWrite.Load()
+	return lastWrite != 0 && time.Since(time.Unix(0, lastWrite)) < d
+}
+
+// WithReadYourWrites returns a new Context tracking writes made with it, e.g. a request context.
+// Reads with the context go to the primary for ClusterConfig.Stickiness after a write, so they see it
+// even when replicas lag behind.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyStickiness, &stickiness{})
+}
+
+// MarkWrite records a write made with the read-your-writes context. Writes made with Cluster
+// are recorded automatically, MarkWrite is needed for writes made with Primary directly.
+func MarkWrite(ctx context.Context) {
+	if s, ok := ctx.Value(contextKeyStickiness).(*stickiness); ok {
+		s.lastWrite.Store(time.Now().UnixNano())
+	}
+}
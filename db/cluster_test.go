@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/monetha/mth-core/db/internal/fakedb"
+	"github.com/stretchr/testify/require"
+)
+
+// testReplica returns a database answering health checks, failing them when down is set.
+func testReplica(t *testing.T, down *atomic.Bool) *sql.DB {
+	db := fakedb.Open(func(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+		if down.Load() {
+			return fakedb.Result{Err: errors.New("connection refused")}
+		}
+		return fakedb.Row(int64(1))
+	})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	r := require.New(t)
+
+	var down1, down2 atomic.Bool
+	primary := testReplica(t, new(atomic.Bool))
+	replica1, replica2 := testReplica(t, &down1), testReplica(t, &down2)
+
+	c := NewCluster(primary, []*sql.DB{replica1, replica2}, ClusterConfig{})
+	ctx := context.Background()
+
+	first, second := c.Replica(ctx), c.Replica(ctx)
+	r.NotEqual(first, second)
+	r.ElementsMatch([]*sql.DB{replica1, replica2}, []*sql.DB{first, second})
+	r.Equal(primary, c.Primary())
+
+	down1.Store(true)
+	c.checkReplicas()
+	r.Equal(replica2, c.Replica(ctx))
+	r.Equal(replica2, c.Replica(ctx))
+
+	down2.Store(true)
+	c.checkReplicas()
+	r.Equal(primary, c.Replica(ctx))
+
+	down1.Store(false)
+	c.checkReplicas()
+	r.Equal(replica1, c.Replica(ctx))
+}
+
+func TestClusterStartClose(t *testing.T) {
+	r := require.New(t)
+
+	// closing a cluster which wasn't started returns immediately
+	c := NewCluster(testReplica(t, new(atomic.Bool)), nil, ClusterConfig{})
+	r.NoError(c.Close())
+
+	// repeated calls are ignored
+	c = NewCluster(testReplica(t, new(atomic.Bool)), []*sql.DB{testReplica(t, new(atomic.Bool))}, ClusterConfig{})
+	c.Start()
+	c.Start()
+	r.NoError(c.Close())
+	r.NoError(c.Close())
+}
+
+func TestClusterLeastLatency(t *testing.T) {
+	r := require.New(t)
+
+	replica1, replica2 := testReplica(t, new(atomic.Bool)), testReplica(t, new(atomic.Bool))
+	c := NewCluster(testReplica(t, new(atomic.Bool)), []*sql.DB{replica1, replica2}, ClusterConfig{Balancer: LeastLatency})
+
+	c.replicas[0].latency.Store(int64(20))
+	c.replicas[1].latency.Store(int64(10))
+	r.Equal(replica2, c.Replica(context.Background()))
+
+	c.replicas[1].healthy.Store(false)
+	r.Equal(replica1, c.Replica(context.Background()))
+}
+
+func TestClusterIdleReplicas(t *testing.T) {
+	r := require.New(t)
+
+	// replicas of an idle primary replayed all WAL, but the last transaction is an hour old
+	var caughtUp atomic.Bool
+	caughtUp.Store(true)
+	replica := fakedb.Open(func(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+		if strings.Contains(query, "pg_is_in_recovery") {
+			return lagRow(true, caughtUp.Load(), 3600.0)
+		}
+		return fakedb.Row(int64(1))
+	})
+	defer replica.Close()
+
+	primary := testReplica(t, new(atomic.Bool))
+	c := NewCluster(primary, []*sql.DB{replica}, ClusterConfig{HealthCheck: HealthCheckerConfig{MaxReplicationLag: 10 * time.Second}})
+
+	c.checkReplicas()
+	r.Equal(replica, c.Replica(context.Background()))
+
+	// replay falls behind receive, so the replica lags
+	caughtUp.Store(false)
+	c.checkReplicas()
+	r.Equal(primary, c.Replica(context.Background()))
+}
+
+func TestClusterReadYourWrites(t *testing.T) {
+	r := require.New(t)
+
+	primary, replica := testReplica(t, new(atomic.Bool)), testReplica(t, new(atomic.Bool))
+	c := NewCluster(primary, []*sql.DB{replica}, ClusterConfig{})
+
+	ctx := WithReadYourWrites(context.Background())
+	r.Equal(replica, c.Replica(ctx))
+
+	_, err := c.ExecContext(ctx, "UPDATE t SET a = 1")
+	r.NoError(err)
+	r.Equal(primary, c.Replica(ctx))
+	r.Equal(replica, c.Replica(context.Background()))
+}
@@ -0,0 +1,4 @@
+// Package db provides helpers for services using Postgres through database/sql:
+// health checking of the database, transactions retried on serialization failures and deadlocks,
+// and Cluster routing reads to replicas and writes to the primary.
+package db
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheckerConfig is the HealthChecker configuration.
+type HealthCheckerConfig struct {
+	// Timeout bounds the whole check. Default to 5s.
+	Timeout time.Duration
+
+	// MaxReplicationLag is the maximum replication lag of a replica. The lag is checked when the server
+	// is in recovery only, so the same config can be used for the primary and replicas. A replica streaming
+	// WAL from the primary which replayed all received WAL has no lag, even when the primary is idle.
+	// Whether WAL is streamed is read from pg_stat_wal_receiver, which requires the pg_read_all_stats role,
+	// otherwise the lag is the age of the last replayed transaction. Zero disables the check.
+	MaxReplicationLag time.Duration
+
+	// MigrationsTable is the table holding applied schema migrations in the version column.
+	// Empty table disables the migration version check.
+	MigrationsTable string
+
+	// MinMigrationVersion is the minimal schema migration version the service works with.
+	MinMigrationVersion int64
+}
+
+// PoolStats are connection pool statistics.
+type PoolStats struct {
+	Open      int           // established connections, both in use and idle
+	InUse     int           // connections currently in use
+	Idle      int           // idle connections
+	WaitCount int64         // total number of connections waited for
+	WaitTime  time.Duration // total time blocked waiting for a new connection
+}
+
+// String implements fmt.Stringer.
+func (s PoolStats) String() string {
+	return fmt.Sprintf("open=%d in_use=%d idle=%d wait_count=%d wait_time=%v", s.Open, s.InUse, s.Idle, s.WaitCount, s.WaitTime)
+}
+
+// HealthChecker checks health of Postgres database, it implements healthcheck.HealthChecker:
+//
+//	healthcheck.AddDependency("postgres", db.NewHealthChecker(sqlDB, db.HealthCheckerConfig{}), 10*time.Second)
+type HealthChecker struct {
+	db     *sql.DB
+	config HealthCheckerConfig
+}
+
+// NewHealthChecker creates a health checker of the database.
+func NewHealthChecker(db *sql.DB, config HealthCheckerConfig) *HealthChecker {
+	if config.Timeout == 0 {
+		config.Timeout = defaultHealthCheckTimeout
+	}
+	return &HealthChecker{db: db, config: config}
+}
+
+// CheckHealth implements healthcheck.HealthChecker.
+func (h *HealthChecker) CheckHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+
+	return h.Check(ctx)
+}
+
+// Check runs SELECT 1 and the configured checks. Errors describe the failed check, and contain
+// pool stats when the database can't be reached, as the exhausted pool is a common cause.
+func (h *HealthChecker) Check(ctx context.Context) error {
+	var one int
+	if err := h.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("postgres: SELECT 1 failed (%v): %w", h.Stats(), err)
+	}
+
+	if h.config.MaxReplicationLag > 0 {
+		if err := h.checkReplicationLag(ctx); err != nil {
+			return err
+		}
+	}
+
+	if h.config.MigrationsTable != "" {
+		if err := h.checkMigrationVersion(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats returns connection pool statistics.
+func (h *HealthChecker) Stats() PoolStats {
+	s := h.db.Stats()
+	return PoolStats{
+		Open:      s.OpenConnections,
+		InUse:     s.InUse,
+		Idle:      s.Idle,
+		WaitCount: s.WaitCount,
+		WaitTime:  s.WaitDuration,
+	}
+}
+
+func (h *HealthChecker) checkReplicationLag(ctx context.Context) error {
+	// the replay timestamp stops moving when the primary is idle, so a replica streaming WAL which replayed
+	// all received WAL is caught up whatever the timestamp is. Without a streaming WAL receiver, received WAL
+	// stops moving too, so the replay timestamp is checked. The lag is NULL until a replica replays the first
+	// transaction.
+	var (
+		inRecovery, caughtUp bool
+		lag                  sql.NullFloat64
+	)
+	err := h.db.QueryRowContext(ctx,
+		"SELECT pg_is_in_recovery(), "+
+			"COALESCE(pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() "+
+			"AND EXISTS (SELECT true FROM pg_stat_wal_receiver WHERE status = 'streaming'), false), "+
+			"EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())",
+	).Scan(&inRecovery, &caughtUp, &lag)
+	if err != nil {
+		return fmt.Errorf("postgres: checking replication lag: %w", err)
+	}
+
+	if !inRecovery || caughtUp || !lag.Valid {
+		return nil
+	}
+
+	if d := time.Duration(lag.Float64 * float64(time.Second)); d > h.config.MaxReplicationLag {
+		return fmt.Errorf("postgres: replication lag %v exceeds %v", d.Round(time.Millisecond), h.config.MaxReplicationLag)
+	}
+	return nil
+}
+
+func (h *HealthChecker) checkMigrationVersion(ctx context.Context) error {
+	var version sql.NullInt64
+	err := h.db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", h.config.MigrationsTable)).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("postgres: checking migration version in %s: %w", h.config.MigrationsTable, err)
+	}
+
+	if !version.Valid {
+		return errors.New("postgres: no schema migrations applied")
+	}
+
+	if version.Int64 < h.config.MinMigrationVersion {
+		return fmt.Errorf("postgres: schema migration version %d is lower than required %d", version.Int64, h.config.MinMigrationVersion)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monetha/mth-core/db/internal/fakedb"
+	"github.com/stretchr/testify/require"
+)
+
+// lagRow returns a result of the replication lag query.
+func lagRow(inRecovery, caughtUp bool, lag driver.Value) fakedb.Result {
+	return fakedb.Result{
+		Columns: []string{"in_recovery", "caught_up", "lag"},
+		Rows:    [][]driver.Value{{inRecovery, caughtUp, lag}},
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HealthCheckerConfig
+		results map[string]fakedb.Result
+		err     string
+	}{
+		{
+			name:    "ok",
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1))},
+		},
+		{
+			name:    "select failed",
+			results: map[string]fakedb.Result{"SELECT 1": {Err: errors.New("connection refused")}},
+			err:     "postgres: SELECT 1 failed (open=",
+		},
+		{
+			name:    "replica lagging",
+			config:  HealthCheckerConfig{MaxReplicationLag: 10 * time.Second},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "pg_is_in_recovery": lagRow(true, false, 45.5)},
+			err:     "postgres: replication lag 45.5s exceeds 10s",
+		},
+		{
+			name:    "replica of idle primary",
+			config:  HealthCheckerConfig{MaxReplicationLag: 10 * time.Second},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "pg_is_in_recovery": lagRow(true, true, 3600.0)},
+		},
+		{
+			name:    "replica without streaming receiver",
+			config:  HealthCheckerConfig{MaxReplicationLag: 10 * time.Second},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "pg_stat_wal_receiver": lagRow(true, false, 3600.0)},
+			err:     "postgres: replication lag 1h0m0s exceeds 10s",
+		},
+		{
+			name:    "replica before first replay",
+			config:  HealthCheckerConfig{MaxReplicationLag: 10 * time.Second},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "pg_is_in_recovery": lagRow(true, false, nil)},
+		},
+		{
+			name:    "primary",
+			config:  HealthCheckerConfig{MaxReplicationLag: 10 * time.Second},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "pg_is_in_recovery": lagRow(false, true, nil)},
+		},
+		{
+			name:    "migration outdated",
+			config:  HealthCheckerConfig{MigrationsTable: "schema_migrations", MinMigrationVersion: 5},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "schema_migrations": fakedb.Row(int64(3))},
+			err:     "postgres: schema migration version 3 is lower than required 5",
+		},
+		{
+			name:    "no migrations",
+			config:  HealthCheckerConfig{MigrationsTable: "schema_migrations"},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "schema_migrations": fakedb.Row(nil)},
+			err:     "postgres: no schema migrations applied",
+		},
+		{
+			name:    "migration current",
+			config:  HealthCheckerConfig{MigrationsTable: "schema_migrations", MinMigrationVersion: 5},
+			results: map[string]fakedb.Result{"SELECT 1": fakedb.Row(int64(1)), "schema_migrations": fakedb.Row(int64(5))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakedb.Open(func(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+				for q, res := range tt.results {
+					if strings.Contains(query, q) {
+						return res
+					}
+				}
+				t.Fatalf("unexpected query: %s", query)
+				return fakedb.Result{}
+			})
+			defer db.Close()
+
+			err := NewHealthChecker(db, tt.config).CheckHealth()
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
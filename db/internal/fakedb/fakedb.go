@@ -0,0 +1,124 @@
+// Package fakedb is a database/sql driver answering queries with a handler, used in tests.
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Result is a result of a query.
+type Result struct {
+	Columns []string
+	Rows    [][]driver.Value
+	Err     error
+}
+
+// Handler handles queries of the database, BEGIN, COMMIT and ROLLBACK are passed to it as well.
+type Handler func(ctx context.Context, query string, args []driver.NamedValue) Result
+
+var (
+	mu       sync.Mutex
+	handlers = map[string]Handler{}
+	seq      int64
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// Open opens a database whose queries are handled by the handler.
+func Open(h Handler) *sql.DB {
+	name := strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+
+	mu.Lock()
+	handlers[name] = h
+	mu.Unlock()
+
+	db, err := sql.Open("fakedb", name)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return &fakeConn{h: handlers[name]}, nil
+}
+
+type fakeConn struct {
+	h Handler
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.ExecContext(ctx, "BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &fakeTx{c: c}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.h(ctx, query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &fakeRows{columns: res.Columns, rows: res.Rows}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.h(ctx, query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(len(res.Rows)), nil
+}
+
+type fakeTx struct {
+	c *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	_, err := tx.c.ExecContext(context.Background(), "COMMIT", nil)
+	return err
+}
+
+func (tx *fakeTx) Rollback() error {
+	_, err := tx.c.ExecContext(context.Background(), "ROLLBACK", nil)
+	return err
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Row returns a result of a single row with a single column.
+func Row(v driver.Value) Result {
+	return Result{Columns: []string{"v"}, Rows: [][]driver.Value{{v}}}
+}
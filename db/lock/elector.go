@@ -0,0 +1,146 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultElectionRetryInterval = 5 * time.Second
+	defaultElectionCheckInterval = 5 * time.Second
+	unlockTimeout                = 5 * time.Second
+)
+
+// ElectorConfig is the LeaderElector configuration.
+type ElectorConfig struct {
+	// DB is the database the leadership lock is held in.
+	DB *sql.DB
+
+	// Name is the name of the leadership lock, e.g. the name of the scheduled job.
+	Name string
+
+	// OnElected is called when the leadership is acquired. The context is canceled when the leadership
+	// is revoked, so leader work started with it stops. OnElected must not block.
+	OnElected func(ctx context.Context)
+
+	// OnRevoked is called when the leadership is revoked, because the connection holding it was lost
+	// or the elector stopped.
+	OnRevoked func()
+
+	// RetryInterval is a regular interval for trying to acquire the leadership. Default to 5s.
+	RetryInterval time.Duration
+
+	// CheckInterval is a regular interval for checking the connection holding the leadership. Default to 5s.
+	// The check is bounded by the pq-timeouts read timeout of the connection.
+	CheckInterval time.Duration
+
+	// Logger is the logger used. Default to zap.L().
+	Logger *zap.Logger
+}
+
+// defaults for configuration
+func (c *ElectorConfig) defaults() {
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultElectionRetryInterval
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = defaultElectionCheckInterval
+	}
+	if c.OnElected == nil {
+		c.OnElected = func(context.Context) {}
+	}
+	if c.OnRevoked == nil {
+		c.OnRevoked = func() {}
+	}
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+	if c.DB == nil {
+		panic("lock: DB must be set")
+	}
+	if len(c.Name) == 0 {
+		panic("lock: Name length must be at least 1")
+	}
+}
+
+// LeaderElector elects a single leader among replicas of a service. The leadership is held
+// on a dedicated connection until the elector stops or the connection is lost.
+type LeaderElector struct {
+	*ElectorConfig
+	locker *Locker
+	leader atomic.Bool
+}
+
+// NewLeaderElector creates a leader elector with the given config.
+func NewLeaderElector(config *ElectorConfig) *LeaderElector {
+	config.defaults()
+	return &LeaderElector{
+		ElectorConfig: config,
+		locker:        NewLocker(config.DB),
+	}
+}
+
+// IsLeader reports whether the elector holds the leadership.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run takes part in the election until the context is done, the leadership is released before returning.
+func (e *LeaderElector) Run(ctx context.Context) {
+	l := e.Logger.With(zap.String("lock", e.Name))
+
+	for {
+		lock, err := e.locker.TryLock(ctx, e.Name)
+		switch {
+		case err == nil:
+			e.lead(ctx, lock, l)
+		case ctx.Err() == nil && !errors.Is(err, ErrLocked):
+			l.With(zap.Error(err)).Warn("acquire leadership")
+		}
+
+		if !sleep(ctx, e.RetryInterval) {
+			return
+		}
+	}
+}
+
+// lead holds the leadership until the context is done or the connection holding the lock is lost.
+func (e *LeaderElector) lead(ctx context.Context, lock *Lock, l *zap.Logger) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+
+	l.Info("leadership acquired")
+	e.leader.Store(true)
+	e.OnElected(leaderCtx)
+
+	ticker := time.NewTicker(e.CheckInterval)
+	for leading := true; leading; {
+		select {
+		case <-ctx.Done():
+			leading = false
+		case <-ticker.C:
+			if err := lock.Check(ctx); err != nil {
+				if ctx.Err() == nil {
+					l.With(zap.Error(err)).Warn("leadership lost")
+				}
+				leading = false
+			}
+		}
+	}
+	ticker.Stop()
+
+	cancel()
+	e.leader.Store(false)
+	e.OnRevoked()
+
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer unlockCancel()
+	if err := lock.Unlock(unlockCtx); err != nil {
+		l.With(zap.Error(err)).Warn("release leadership")
+	}
+	l.Info("leadership released")
+}
@@ -0,0 +1,142 @@
+// Package lock provides distributed locks and leader election built on Postgres session advisory locks.
+//
+// A lock is held by the session of a dedicated connection taken from the pool, and is released by
+// the server when the session ends, so a crashed holder never keeps the lock. Open the database with
+// the pq-timeouts driver and read_timeout set, so the loss of the connection holding the lock is detected
+// in time.
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// DefaultRetryInterval is the interval of lock acquisition attempts of Lock.
+const DefaultRetryInterval = time.Second
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by another session.
+	ErrLocked = errors.New("lock is held by another session")
+
+	errNotHeld = errors.New("lock was not held")
+)
+
+// Key returns the advisory lock key of the lock name.
+func Key(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// Locker acquires named locks of the database.
+type Locker struct {
+	db *sql.DB
+
+	// RetryInterval is the interval of lock acquisition attempts of Lock. Default to DefaultRetryInterval.
+	RetryInterval time.Duration
+}
+
+// NewLocker creates a locker of the database.
+func NewLocker(db *sql.DB) *Locker {
+	return &Locker{db: db, RetryInterval: DefaultRetryInterval}
+}
+
+// TryLock tries to acquire the named lock without waiting. ErrLocked is returned when the lock is held
+// by another session.
+func (l *Locker) TryLock(ctx context.Context, name string) (*Lock, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+
+	key := Key(name)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		discard(conn)
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+
+	if !acquired {
+		conn.Close()
+		return nil, fmt.Errorf("lock %s: %w", name, ErrLocked)
+	}
+
+	return &Lock{name: name, key: key, conn: conn}, nil
+}
+
+// Lock acquires the named lock, waiting until it's released by the current holder or the context is done.
+func (l *Locker) Lock(ctx context.Context, name string) (*Lock, error) {
+	for {
+		lock, err := l.TryLock(ctx, name)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+
+		if !sleep(ctx, l.RetryInterval) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Lock is an acquired lock.
+type Lock struct {
+	name string
+	key  int64
+	conn *sql.Conn
+}
+
+// Name returns the lock name.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Check checks the connection holding the lock is alive, so the lock is still held.
+func (l *Lock) Check(ctx context.Context) error {
+	if _, err := l.conn.ExecContext(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("lock %s: connection lost: %w", l.name, err)
+	}
+	return nil
+}
+
+// Unlock releases the lock. When the lock can't be released, the connection holding it is closed,
+// so the server releases the lock with the session.
+func (l *Lock) Unlock(ctx context.Context) error {
+	var released bool
+	if err := l.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released); err != nil {
+		discard(l.conn)
+		return fmt.Errorf("unlock %s: %w", l.name, err)
+	}
+
+	if err := l.conn.Close(); err != nil {
+		return fmt.Errorf("unlock %s: %w", l.name, err)
+	}
+
+	if !released {
+		return fmt.Errorf("unlock %s: %w", l.name, errNotHeld)
+	}
+	return nil
+}
+
+// discard closes the connection instead of returning it to the pool, ending its session.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// sleep waits for the duration and reports whether the context is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,147 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monetha/mth-core/db/internal/fakedb"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer simulates advisory locks of a database server shared by several clients.
+type testServer struct {
+	mu     sync.Mutex
+	locks  map[int64]bool
+	broken bool // SELECT 1 fails as if the connection was lost
+}
+
+func newTestServer() *testServer {
+	return &testServer{locks: make(map[int64]bool)}
+}
+
+func (s *testServer) open(t *testing.T) *sql.DB {
+	db := fakedb.Open(func(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(query, "SELECT pg_try_advisory_lock"):
+			key := args[0].Value.(int64)
+			if s.locks[key] {
+				return fakedb.Row(false)
+			}
+			s.locks[key] = true
+			return fakedb.Row(true)
+		case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+			key := args[0].Value.(int64)
+			held := s.locks[key]
+			delete(s.locks, key)
+			return fakedb.Row(held)
+		case query == "SELECT 1" && s.broken:
+			return fakedb.Result{Err: errors.New("read: i/o timeout")}
+		}
+		return fakedb.Row(int64(1))
+	})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (s *testServer) setBroken(broken bool) {
+	s.mu.Lock()
+	s.broken = broken
+	s.mu.Unlock()
+}
+
+func TestTryLock(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	s := newTestServer()
+	locker1, locker2 := NewLocker(s.open(t)), NewLocker(s.open(t))
+
+	lock, err := locker1.TryLock(ctx, "job")
+	r.NoError(err)
+	r.Equal("job", lock.Name())
+	r.NoError(lock.Check(ctx))
+
+	_, err = locker2.TryLock(ctx, "job")
+	r.True(errors.Is(err, ErrLocked))
+
+	other, err := locker2.TryLock(ctx, "other")
+	r.NoError(err)
+	r.NoError(other.Unlock(ctx))
+
+	r.NoError(lock.Unlock(ctx))
+	lock, err = locker2.TryLock(ctx, "job")
+	r.NoError(err)
+	r.NoError(lock.Unlock(ctx))
+}
+
+func TestLockWaits(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	s := newTestServer()
+	locker1, locker2 := NewLocker(s.open(t)), NewLocker(s.open(t))
+	locker2.RetryInterval = time.Millisecond
+
+	lock, err := locker1.Lock(ctx, "job")
+	r.NoError(err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = locker2.Lock(timeoutCtx, "job")
+	r.True(errors.Is(err, context.DeadlineExceeded))
+
+	time.AfterFunc(5*time.Millisecond, func() { _ = lock.Unlock(ctx) })
+	lock, err = locker2.Lock(ctx, "job")
+	r.NoError(err)
+	r.NoError(lock.Unlock(ctx))
+}
+
+func TestLeaderElector(t *testing.T) {
+	r := require.New(t)
+
+	s := newTestServer()
+	elected := make(chan context.Context, 2)
+	revoked := make(chan struct{}, 2)
+
+	e := NewLeaderElector(&ElectorConfig{
+		DB:            s.open(t),
+		Name:          "job",
+		OnElected:     func(ctx context.Context) { elected <- ctx },
+		OnRevoked:     func() { revoked <- struct{}{} },
+		RetryInterval: time.Millisecond,
+		CheckInterval: time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	leaderCtx := <-elected
+	r.True(e.IsLeader())
+
+	// connection loss revokes the leadership
+	s.setBroken(true)
+	<-revoked
+	<-leaderCtx.Done()
+	s.setBroken(false)
+
+	leaderCtx = <-elected
+	cancel()
+	<-done
+	<-revoked
+	r.Error(leaderCtx.Err())
+	r.False(e.IsLeader())
+	r.Empty(s.locks)
+}
@@ -0,0 +1,396 @@
+// Package migrate applies SQL schema migrations to Postgres.
+//
+// Migrations are SQL files named <version>_<name>.up.sql and <version>_<name>.down.sql, usually embedded
+// into the service binary:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	m, err := migrate.New(db, migrations, "migrations", migrate.Config{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := m.Up(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Applied versions and checksums of migrations are kept in the schema_migrations table. Modified applied
+// migrations are detected and reported with ModifiedError. A Postgres advisory lock is held while migrating,
+// so only one replica of the service migrates at a time. Each migration runs in its own transaction.
+//
+// The database can be opened with any driver, with pq-timeouts read_timeout is overridden by Config.ReadTimeout.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/monetha/mth-core/db/pqtimeouts"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTable             = "schema_migrations"
+	defaultLockRetryInterval = time.Second
+)
+
+// Latest is the target version of the latest migration.
+const Latest int64 = -1
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a schema migration.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// Step is a migration applied or reverted when migrating to the target version.
+type Step struct {
+	Migration
+	Revert bool // the migration is reverted with the down file
+}
+
+// String implements fmt.Stringer.
+func (s Step) String() string {
+	dir := "up"
+	if s.Revert {
+		dir = "down"
+	}
+	return fmt.Sprintf("%d_%s %s", s.Version, s.Name, dir)
+}
+
+// ModifiedError is returned when an applied migration doesn't match the migration file anymore.
+type ModifiedError struct {
+	Version int64
+	Name    string
+}
+
+// Error implements error.
+func (e *ModifiedError) Error() string {
+	return fmt.Sprintf("migrate: applied migration %d_%s was modified", e.Version, e.Name)
+}
+
+// Config is the Migrator configuration.
+type Config struct {
+	// Table is the table keeping applied migrations. Default to schema_migrations.
+	Table string
+
+	// LockID is the key of the advisory lock held while migrating. Default to a hash of the table name.
+	LockID int64
+
+	// LockRetryInterval is the interval of lock acquisition attempts while another replica migrates.
+	// Default to 1s.
+	LockRetryInterval time.Duration
+
+	// DryRun logs migration steps without applying them.
+	DryRun bool
+
+	// ReadTimeout overrides read_timeout of pq-timeouts connections, as migrations often take longer
+	// than regular queries. Zero keeps the connection setting.
+	ReadTimeout time.Duration
+
+	// Logger is the logger used. Default to zap.L().
+	Logger *zap.Logger
+}
+
+// defaults for configuration
+func (c *Config) defaults() {
+	if c.Table == "" {
+		c.Table = defaultTable
+	}
+	if c.LockID == 0 {
+		h := fnv.New64a()
+		h.Write([]byte("migrate:" + c.Table))
+		c.LockID = int64(h.Sum64())
+	}
+	if c.LockRetryInterval == 0 {
+		c.LockRetryInterval = defaultLockRetryInterval
+	}
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+}
+
+// Migrator applies migrations to the database.
+type Migrator struct {
+	config     Config
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads migrations from the directory of the file system and creates a migrator.
+func New(db *sql.DB, fsys fs.FS, dir string, config Config) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	config.defaults()
+	return &Migrator{config: config, db: db, migrations: migrations}, nil
+}
+
+// Load loads migrations from the directory of the file system, ordered by version.
+// Files not matching migration file names are ignored. Down migrations are optional.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileNameRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of %s: %w", e.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: migrations %d_%s and %d_%s have the same version", version, mig.Name, version, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(b)
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migrate: migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies all migrations not applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	_, err := m.Migrate(ctx, Latest)
+	return err
+}
+
+// Migrate migrates the database to the target version, applying or reverting migrations.
+// Target version 0 reverts all migrations, Latest applies all of them. Migration steps are returned,
+// in dry-run mode they are only logged.
+func (m *Migrator) Migrate(ctx context.Context, target int64) (steps []Step, err error) {
+	if m.config.ReadTimeout > 0 {
+		ctx = pqtimeouts.WithReadTimeout(ctx, m.config.ReadTimeout)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+
+	// session level advisory lock has to be released with the same connection
+	if err := m.lock(ctx, conn); err != nil {
+		return nil, fmt.Errorf("migrate: acquiring lock: %w", err)
+	}
+	defer func() {
+		if _, uerr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.config.LockID); uerr != nil && err == nil {
+			err = fmt.Errorf("migrate: releasing lock: %w", uerr)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.config.Table)); err != nil {
+		return nil, fmt.Errorf("migrate: creating %s: %w", m.config.Table, err)
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err = m.plan(applied, target)
+	if err != nil {
+		return nil, err
+	}
+
+	l := m.config.Logger.With(zap.String("table", m.config.Table))
+	for _, s := range steps {
+		if m.config.DryRun {
+			l.Info("dry-run migration", zap.Stringer("migration", s))
+			continue
+		}
+
+		start := time.Now()
+		if err := m.apply(ctx, conn, s); err != nil {
+			return nil, fmt.Errorf("migrate: %v: %w", s, err)
+		}
+		l.Info("migration applied", zap.Stringer("migration", s), zap.Duration("duration", time.Since(start)))
+	}
+
+	return steps, nil
+}
+
+// lock acquires the advisory lock, retrying until the context is done while another replica migrates.
+// The lock isn't waited for by the server, as the wait would be cut by the read timeout of the connection.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	for logged := false; ; logged = true {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", m.config.LockID).Scan(&locked); err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		if !logged {
+			m.config.Logger.Info("waiting for another migration to finish", zap.Int64("lock_id", m.config.LockID))
+		}
+		t := time.NewTimer(m.config.LockRetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// appliedMigration is a row of the migrations table.
+type appliedMigration struct {
+	name     string
+	checksum string
+}
+
+// applied returns applied migrations by version.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, name, checksum FROM %s", m.config.Table))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: reading %s: %w", m.config.Table, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var (
+			version int64
+			a       appliedMigration
+		)
+		if err := rows.Scan(&version, &a.name, &a.checksum); err != nil {
+			return nil, fmt.Errorf("migrate: reading %s: %w", m.config.Table, err)
+		}
+		applied[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: reading %s: %w", m.config.Table, err)
+	}
+
+	return applied, nil
+}
+
+// plan returns steps migrating the database with the applied migrations to the target version.
+func (m *Migrator) plan(applied map[int64]appliedMigration, target int64) ([]Step, error) {
+	known := make(map[int64]struct{}, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = struct{}{}
+		if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+			return nil, &ModifiedError{Version: mig.Version, Name: mig.Name}
+		}
+	}
+	for version, a := range applied {
+		if _, ok := known[version]; !ok {
+			return nil, fmt.Errorf("migrate: applied migration %d_%s is unknown", version, a.name)
+		}
+	}
+
+	if target != Latest && target != 0 {
+		if _, ok := known[target]; !ok {
+			return nil, fmt.Errorf("migrate: unknown target version %d", target)
+		}
+	}
+
+	var steps []Step
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok && (target == Latest || mig.Version <= target) {
+			steps = append(steps, Step{Migration: mig})
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; ok && target != Latest && mig.Version > target {
+			if mig.Down == "" {
+				return nil, fmt.Errorf("migrate: migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+			steps = append(steps, Step{Migration: mig, Revert: true})
+		}
+	}
+
+	return steps, nil
+}
+
+// apply applies or reverts the migration in a transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, s Step) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+				m.config.Logger.With(zap.Error(rerr)).Warn("rollback migration")
+			}
+		}
+	}()
+
+	if s.Revert {
+		if _, err = tx.ExecContext(ctx, s.Down); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.config.Table), s.Version)
+	} else {
+		if _, err = tx.ExecContext(ctx, s.Up); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.config.Table),
+			s.Version, s.Name, s.Checksum)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
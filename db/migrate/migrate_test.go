@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/monetha/mth-core/db/internal/fakedb"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"migrations/0001_users.up.sql":     {Data: []byte("CREATE TABLE users (id BIGINT)")},
+	"migrations/0001_users.down.sql":   {Data: []byte("DROP TABLE users")},
+	"migrations/0002_orders.up.sql":    {Data: []byte("CREATE TABLE orders (id BIGINT)")},
+	"migrations/0002_orders.down.sql":  {Data: []byte("DROP TABLE orders")},
+	"migrations/0003_user_name.up.sql": {Data: []byte("ALTER TABLE users ADD name TEXT")},
+	"migrations/README.md":             {Data: []byte("migrations")},
+}
+
+// testDB simulates the migrations table and records executed migration statements.
+type testDB struct {
+	applied  map[int64][]driver.Value
+	executed []string
+	locked   bool
+	busy     int // lock attempts failing as another replica migrates
+}
+
+func (d *testDB) handle(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_try_advisory_lock"):
+		if d.busy > 0 {
+			d.busy--
+			return fakedb.Row(false)
+		}
+		d.locked = true
+		return fakedb.Row(true)
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		d.locked = false
+	case strings.HasPrefix(query, "SELECT version"):
+		res := fakedb.Result{Columns: []string{"version", "name", "checksum"}}
+		for _, row := range d.applied {
+			res.Rows = append(res.Rows, row)
+		}
+		return res
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		d.applied[args[0].Value.(int64)] = []driver.Value{args[0].Value, args[1].Value, args[2].Value}
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		delete(d.applied, args[0].Value.(int64))
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS"), query == "BEGIN", query == "COMMIT", query == "ROLLBACK":
+	default:
+		d.executed = append(d.executed, query)
+	}
+	return fakedb.Result{}
+}
+
+func newTestMigrator(t *testing.T, config Config) (*Migrator, *testDB) {
+	d := &testDB{applied: make(map[int64][]driver.Value)}
+	db := fakedb.Open(d.handle)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, testFS, "migrations", config)
+	require.NoError(t, err)
+	return m, d
+}
+
+func TestLoad(t *testing.T) {
+	r := require.New(t)
+
+	migrations, err := Load(testFS, "migrations")
+	r.NoError(err)
+	r.Len(migrations, 3)
+	r.Equal(int64(1), migrations[0].Version)
+	r.Equal("users", migrations[0].Name)
+	r.Equal("DROP TABLE users", migrations[0].Down)
+	r.Equal(int64(3), migrations[2].Version)
+	r.Empty(migrations[2].Down)
+	r.Len(migrations[2].Checksum, 64)
+
+	_, err = Load(fstest.MapFS{"m/0001_a.down.sql": {}}, "m")
+	r.Error(err)
+
+	_, err = Load(fstest.MapFS{"m/0001_a.up.sql": {}, "m/0001_b.up.sql": {}}, "m")
+	r.Error(err)
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	m, d := newTestMigrator(t, Config{})
+
+	steps, err := m.Migrate(ctx, 2)
+	r.NoError(err)
+	r.Len(steps, 2)
+	r.Equal([]string{"CREATE TABLE users (id BIGINT)", "CREATE TABLE orders (id BIGINT)"}, d.executed)
+	r.False(d.locked)
+
+	r.NoError(m.Up(ctx))
+	r.Len(d.applied, 3)
+	r.Equal("ALTER TABLE users ADD name TEXT", d.executed[2])
+
+	// the latest migration has no down file
+	_, err = m.Migrate(ctx, 1)
+	r.Error(err)
+
+	delete(d.applied, 3)
+	steps, err = m.Migrate(ctx, 1)
+	r.NoError(err)
+	r.Len(steps, 1)
+	r.True(steps[0].Revert)
+	r.Equal("DROP TABLE orders", d.executed[3])
+	r.Len(d.applied, 1)
+
+	_, err = m.Migrate(ctx, 7)
+	r.Error(err)
+}
+
+func TestMigrateWaitsForLock(t *testing.T) {
+	r := require.New(t)
+
+	m, d := newTestMigrator(t, Config{LockRetryInterval: time.Millisecond})
+
+	d.busy = 3
+	r.NoError(m.Up(context.Background()))
+	r.Len(d.applied, 3)
+	r.False(d.locked)
+
+	d.busy = math.MaxInt
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := m.Migrate(ctx, Latest)
+	r.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	r := require.New(t)
+
+	m, d := newTestMigrator(t, Config{DryRun: true})
+
+	steps, err := m.Migrate(context.Background(), Latest)
+	r.NoError(err)
+	r.Len(steps, 3)
+	r.Empty(d.executed)
+	r.Empty(d.applied)
+}
+
+func TestMigrateModified(t *testing.T) {
+	r := require.New(t)
+
+	m, d := newTestMigrator(t, Config{})
+	d.applied[1] = []driver.Value{int64(1), "users", "changed"}
+
+	err := m.Up(context.Background())
+	var modified *ModifiedError
+	r.True(errors.As(err, &modified))
+	r.Equal(int64(1), modified.Version)
+	r.Empty(d.executed)
+	r.False(d.locked)
+}
@@ -0,0 +1,295 @@
+// Package notify receives Postgres notifications sent with NOTIFY.
+//
+// The listener connection is dialed with pqtimeouts.TimeoutDialer, so read_timeout and write_timeout
+// of the connection string apply, and the lost connection is detected by pinging the server more often
+// than the read timeout. The connection is re-established with exponential backoff and channels are
+// subscribed again. Notifications sent while the connection was down are lost, so OnResync is called
+// after reconnecting to let the service reload the state it tracks with notifications.
+//
+// Notifications of each channel are queued and passed to its handler by a goroutine of the channel,
+// so slow handlers don't delay pings or notifications of other channels:
+//
+//	l, err := notify.New(&notify.Config{DSN: dsn, OnResync: reloadUsers})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	l.Start()
+//	defer l.Stop()
+//
+//	err = notify.HandleJSON(l, "users", func(u User) error {
+//		return updateUser(u)
+//	})
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/monetha/mth-core/db/pqtimeouts"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMinReconnectInterval = time.Second
+	defaultMaxReconnectInterval = time.Minute
+	defaultPingInterval         = 30 * time.Second
+	defaultQueueSize            = 1024
+)
+
+// Config is the Listener configuration.
+type Config struct {
+	// DSN is the connection string, pq-timeouts parameters are supported.
+	DSN string
+
+	// MinReconnectInterval is the delay of reconnecting after losing the connection,
+	// doubled after each failed attempt up to MaxReconnectInterval. Default to 1s and 1m.
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+
+	// PingInterval is a regular interval for pinging the server. Default to half of read_timeout
+	// of the connection string, or 30s when read_timeout is not set.
+	PingInterval time.Duration
+
+	// OnResync is called after reconnecting, and after notifications of a channel were dropped because
+	// its queue was full, as notifications may have been missed. It may be called concurrently.
+	OnResync func()
+
+	// QueueSize is the number of notifications of a channel queued for its handler. Default to 1024.
+	QueueSize int
+
+	// Logger is the logger used. Default to zap.L().
+	Logger *zap.Logger
+}
+
+// defaults for configuration
+func (c *Config) defaults(readTimeout time.Duration) {
+	if c.MinReconnectInterval == 0 {
+		c.MinReconnectInterval = defaultMinReconnectInterval
+	}
+	if c.MaxReconnectInterval == 0 {
+		c.MaxReconnectInterval = defaultMaxReconnectInterval
+	}
+	if c.PingInterval == 0 {
+		c.PingInterval = defaultPingInterval
+		if readTimeout > 0 {
+			c.PingInterval = readTimeout / 2
+		}
+	}
+	if c.OnResync == nil {
+		c.OnResync = func() {}
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+}
+
+// listener is the part of pq.Listener used, allows it to be stubbed for testing.
+type listener interface {
+	Listen(channel string) error
+	Ping() error
+	Close() error
+	NotificationChannel() <-chan *pq.Notification
+}
+
+// Listener dispatches notifications to handlers of their channels.
+type Listener struct {
+	*Config
+	l listener
+
+	mu       sync.RWMutex
+	handlers map[string]*handler
+	closed   bool // handler queues are closed
+	workers  sync.WaitGroup
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// New creates a listener with the given config. The connection is established in background.
+func New(config *Config) (*Listener, error) {
+	d, dsn, err := pqtimeouts.NewTimeoutDialer(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	config.defaults(d.ReadTimeout())
+
+	l := newListener(config, nil)
+	l.l = pq.NewDialListener(d, dsn, config.MinReconnectInterval, config.MaxReconnectInterval, l.event)
+	return l, nil
+}
+
+func newListener(config *Config, pl listener) *Listener {
+	return &Listener{
+		Config:   config,
+		l:        pl,
+		handlers: make(map[string]*handler),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// handler passes queued notifications of a channel to the handler function.
+type handler struct {
+	channel string
+	h       func(payload string) error
+	queue   chan string
+	dropped atomic.Bool // notifications were dropped since the last resync
+}
+
+// Handle subscribes to the channel, notifications are passed to the handler. Notifications of the channel
+// are queued and passed to the handler sequentially by a goroutine of the channel, errors are logged.
+// When the listener is connected, Handle waits for the server to confirm the subscription,
+// otherwise the channel is subscribed once the connection is established.
+func (l *Listener) Handle(channel string, h func(payload string) error) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return fmt.Errorf("notify: listener is stopped")
+	}
+	if _, ok := l.handlers[channel]; ok {
+		l.mu.Unlock()
+		return fmt.Errorf("notify: channel %s is already handled", channel)
+	}
+	hd := &handler{channel: channel, h: h, queue: make(chan string, l.QueueSize)}
+	l.handlers[channel] = hd
+	l.workers.Add(1)
+	go l.work(hd)
+	l.mu.Unlock()
+
+	if err := l.l.Listen(channel); err != nil {
+		l.mu.Lock()
+		// the queue is closed by Stop once the listener is stopped
+		if !l.closed {
+			delete(l.handlers, channel)
+			close(hd.queue)
+		}
+		l.mu.Unlock()
+		return fmt.Errorf("notify: listen %s: %w", channel, err)
+	}
+	return nil
+}
+
+// HandleJSON subscribes to the channel, JSON payloads of notifications are decoded and passed to the handler.
+func HandleJSON[T any](l *Listener, channel string, h func(v T) error) error {
+	return l.Handle(channel, func(payload string) error {
+		var v T
+		if err := json.Unmarshal([]byte(payload), &v); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		return h(v)
+	})
+}
+
+// Start dispatching notifications.
+func (l *Listener) Start() {
+	l.started.Store(true)
+	go l.loop()
+}
+
+// Stop the listener and close the connection. Queued notifications are handled before returning.
+func (l *Listener) Stop() {
+	l.stopOnce.Do(func() {
+		l.l.Close()
+		close(l.done)
+		if l.started.Load() {
+			<-l.stopped
+		}
+
+		l.mu.Lock()
+		l.closed = true
+		for _, hd := range l.handlers {
+			close(hd.queue)
+		}
+		l.mu.Unlock()
+		l.workers.Wait()
+	})
+}
+
+func (l *Listener) loop() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.PingInterval)
+	defer ticker.Stop()
+
+	notifications := l.l.NotificationChannel()
+	for {
+		select {
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			// nil notification is sent after reconnecting
+			if n == nil {
+				l.Logger.Info("resync after reconnect")
+				l.OnResync()
+				continue
+			}
+			l.dispatch(n)
+		case <-ticker.C:
+			if err := l.l.Ping(); err != nil {
+				l.Logger.With(zap.Error(err)).Warn("ping listener connection")
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// dispatch queues the notification for the handler of its channel, the notification is dropped
+// when the queue is full.
+func (l *Listener) dispatch(n *pq.Notification) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	hd, ok := l.handlers[n.Channel]
+	if !ok {
+		return
+	}
+
+	select {
+	case hd.queue <- n.Extra:
+	default:
+		if !hd.dropped.Swap(true) {
+			l.Logger.With(zap.String("channel", n.Channel)).Error("notification queue is full, dropping notifications")
+		}
+	}
+}
+
+// work passes notifications queued for the handler to it, until the queue is closed.
+// Once the queue is drained after notifications were dropped, OnResync is called.
+func (l *Listener) work(hd *handler) {
+	defer l.workers.Done()
+
+	for payload := range hd.queue {
+		if err := hd.h(payload); err != nil {
+			l.Logger.With(zap.String("channel", hd.channel), zap.Error(err)).Error("handle notification")
+		}
+		if len(hd.queue) == 0 && hd.dropped.Swap(false) {
+			l.Logger.With(zap.String("channel", hd.channel)).Info("resync after dropped notifications")
+			l.OnResync()
+		}
+	}
+}
+
+// event logs connection events of pq.Listener.
+func (l *Listener) event(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected:
+		l.Logger.Info("listener connected")
+	case pq.ListenerEventReconnected:
+		l.Logger.Info("listener reconnected")
+	case pq.ListenerEventDisconnected:
+		l.Logger.With(zap.Error(err)).Warn("listener disconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.Logger.With(zap.Error(err)).Warn("listener connection attempt failed")
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+type testListener struct {
+	mu       sync.Mutex
+	channels []string
+	pings    int
+	closed   bool
+	c        chan *pq.Notification
+}
+
+func (l *testListener) Listen(channel string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if channel == "forbidden" {
+		return errors.New("permission denied")
+	}
+	l.channels = append(l.channels, channel)
+	return nil
+}
+
+func (l *testListener) Ping() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pings++
+	return nil
+}
+
+func (l *testListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+func (l *testListener) NotificationChannel() <-chan *pq.Notification {
+	return l.c
+}
+
+func newTestListener(config *Config) (*Listener, *testListener) {
+	config.defaults(0)
+	tl := &testListener{c: make(chan *pq.Notification)}
+	return newListener(config, tl), tl
+}
+
+type user struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestListenerDispatch(t *testing.T) {
+	r := require.New(t)
+
+	resynced := make(chan struct{}, 1)
+	l, tl := newTestListener(&Config{OnResync: func() { resynced <- struct{}{} }})
+
+	users := make(chan user, 1)
+	r.NoError(HandleJSON(l, "users", func(u user) error {
+		users <- u
+		return nil
+	}))
+	raw := make(chan string, 1)
+	r.NoError(l.Handle("events", func(payload string) error {
+		raw <- payload
+		return nil
+	}))
+	r.Error(l.Handle("events", func(string) error { return nil }))
+	r.Error(l.Handle("forbidden", func(string) error { return nil }))
+	r.Equal([]string{"users", "events"}, tl.channels)
+
+	l.Start()
+
+	tl.c <- &pq.Notification{Channel: "users", Extra: `{"id":1,"name":"John"}`}
+	r.Equal(user{ID: 1, Name: "John"}, <-users)
+
+	// invalid payload and unknown channel are skipped
+	tl.c <- &pq.Notification{Channel: "users", Extra: `{`}
+	tl.c <- &pq.Notification{Channel: "unknown", Extra: "x"}
+
+	tl.c <- &pq.Notification{Channel: "events", Extra: "created"}
+	r.Equal("created", <-raw)
+
+	tl.c <- nil
+	<-resynced
+
+	l.Stop()
+	r.True(tl.closed)
+}
+
+func TestListenerSlowHandler(t *testing.T) {
+	r := require.New(t)
+
+	resynced := make(chan struct{}, 1)
+	l, tl := newTestListener(&Config{PingInterval: time.Millisecond, QueueSize: 1, OnResync: func() { resynced <- struct{}{} }})
+
+	started, release := make(chan struct{}, 3), make(chan struct{})
+	var handled []string
+	r.NoError(l.Handle("jobs", func(payload string) error {
+		started <- struct{}{}
+		<-release
+		handled = append(handled, payload)
+		return nil
+	}))
+	l.Start()
+
+	// the first notification is being handled, the second is queued and the third is dropped
+	tl.c <- &pq.Notification{Channel: "jobs", Extra: "1"}
+	<-started
+	tl.c <- &pq.Notification{Channel: "jobs", Extra: "2"}
+	tl.c <- &pq.Notification{Channel: "jobs", Extra: "3"}
+
+	// pings continue while the handler is blocked
+	require.Eventually(t, func() bool {
+		tl.mu.Lock()
+		defer tl.mu.Unlock()
+		return tl.pings > 1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	<-resynced
+
+	l.Stop()
+	r.Equal([]string{"1", "2"}, handled)
+}
+
+func TestListenerPing(t *testing.T) {
+	l, tl := newTestListener(&Config{PingInterval: time.Millisecond})
+	l.Start()
+
+	require.Eventually(t, func() bool {
+		tl.mu.Lock()
+		defer tl.mu.Unlock()
+		return tl.pings > 1
+	}, time.Second, time.Millisecond)
+
+	l.Stop()
+}
+
+func TestNewPingInterval(t *testing.T) {
+	r := require.New(t)
+
+	l, err := New(&Config{DSN: "host=localhost read_timeout=10s"})
+	r.NoError(err)
+	defer l.Stop()
+	r.Equal(5*time.Second, l.PingInterval)
+
+	_, err = New(&Config{DSN: "host=localhost read_timeout=x"})
+	r.Error(err)
+}
@@ -1,8 +1,10 @@
 package pqtimeouts
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -17,18 +19,79 @@ type timeoutConn struct {
 	conn         net.Conn
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+
+	// expiresAt is the time the connection should be retired by the pool after, zero if never.
+	expiresAt time.Time
+	// closeExpired closes the connection on the first write after expiresAt, when there's no pool retiring it.
+	closeExpired bool
+
+	mu   sync.Mutex
+	stmt statement // settings of the current statement
+}
+
+// expired reports whether the connection reached its maximum age.
+func (t *timeoutConn) expired(now time.Time) bool {
+	return !t.expiresAt.IsZero() && !now.Before(t.expiresAt)
+}
+
+// statement holds settings applied to the connection for the duration of a statement.
+type statement struct {
+	deadline time.Time // deadline all reads and writes must finish before, usually taken from the statement context
+
+	readTimeout     time.Duration // overrides the connection read timeout when hasReadTimeout is set
+	hasReadTimeout  bool
+	writeTimeout    time.Duration // overrides the connection write timeout when hasWriteTimeout is set
+	hasWriteTimeout bool
+}
+
+// setStatement applies the statement settings, zero value restores the connection defaults.
+func (t *timeoutConn) setStatement(stmt statement) {
+	t.mu.Lock()
+	t.stmt = stmt
+	t.mu.Unlock()
+}
+
+// ioDeadline returns the deadline of an I/O operation limited by the read or write timeout,
+// which is tightened to the statement deadline if it comes earlier.
+func (t *timeoutConn) ioDeadline(write bool) (deadline time.Time, timeout time.Duration, byStatement bool) {
+	t.mu.Lock()
+	stmt := t.stmt
+	t.mu.Unlock()
+
+	switch {
+	case write && stmt.hasWriteTimeout:
+		timeout = stmt.writeTimeout
+	case write:
+		timeout = t.writeTimeout
+	case stmt.hasReadTimeout:
+		timeout = stmt.readTimeout
+	default:
+		timeout = t.readTimeout
+	}
+
+	if timeout != 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if !stmt.deadline.IsZero() && (deadline.IsZero() || stmt.deadline.Before(deadline)) {
+		deadline = stmt.deadline
+		byStatement = true
+	}
+
+	return
 }
 
 func (t *timeoutConn) Read(b []byte) (n int, err error) {
 	if t.conn != nil {
-		if t.readTimeout != 0 {
+		deadline, timeout, byStatement := t.ioDeadline(false)
+		if !deadline.IsZero() {
 			// Set a read deadline before we call read.
-			t.conn.SetReadDeadline(time.Now().Add(t.readTimeout))
+			t.conn.SetReadDeadline(deadline)
 		}
 		n, err = t.conn.Read(b)
-		if t.readTimeout != 0 {
+		if !deadline.IsZero() {
 			// Clear the deadline if we have one set
 			t.conn.SetReadDeadline(time.Time{})
+			err = t.wrapTimeoutError("read", timeout, byStatement, err)
 		}
 		return
 	}
@@ -37,20 +100,53 @@ func (t *timeoutConn) Read(b []byte) (n int, err error) {
 
 func (t *timeoutConn) Write(b []byte) (n int, err error) {
 	if t.conn != nil {
-		if t.writeTimeout != 0 {
+		if t.closeExpired && t.expired(time.Now()) {
+			// nothing is written, so pq reports driver.ErrBadConn
+			err = &net.OpError{Op: "write", Net: "tcp", Source: t.conn.LocalAddr(), Addr: t.conn.RemoteAddr(), Err: ErrConnExpired}
+			t.conn.Close()
+			return 0, err
+		}
+
+		deadline, timeout, byStatement := t.ioDeadline(true)
+		if !deadline.IsZero() {
 			// Set a write deadline before we call write.
-			t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+			t.conn.SetWriteDeadline(deadline)
 		}
 		n, err = t.conn.Write(b)
-		if t.writeTimeout != 0 {
+		if !deadline.IsZero() {
 			// Clear the deadline if we have one set
 			t.conn.SetWriteDeadline(time.Time{})
+			err = t.wrapTimeoutError("write", timeout, byStatement, err)
 		}
 		return
 	}
 	return 0, nilConnErr{}
 }
 
+// wrapTimeoutError wraps timeout errors into TimeoutError. The result stays *net.OpError,
+// so pq marks the connection as bad and it's never reused.
+func (t *timeoutConn) wrapTimeoutError(op string, timeout time.Duration, byStatement bool, err error) error {
+	var ne net.Error
+	if err == nil || !errors.As(err, &ne) || !ne.Timeout() {
+		return err
+	}
+
+	te := &TimeoutError{Op: op, Err: err}
+	if !byStatement {
+		te.Duration = timeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		wrapped := *opErr
+		te.Err = opErr.Err
+		wrapped.Err = te
+		return &wrapped
+	}
+
+	return &net.OpError{Op: op, Net: "tcp", Source: t.conn.LocalAddr(), Addr: t.conn.RemoteAddr(), Err: te}
+}
+
 func (t *timeoutConn) Close() (err error) {
 	if t.conn != nil {
 		err = t.conn.Close()
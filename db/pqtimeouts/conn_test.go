@@ -3,6 +3,7 @@ package pqtimeouts
 import (
 	"fmt"
 	"net"
+	"os"
 	"testing"
 	"time"
 )
@@ -42,11 +43,15 @@ type testNetConn struct {
 	setWriteDeadlineTimePrev time.Time
 	setWriteDeadlineTime     time.Time
 	setWriteDeadlineError    error
+	expireReadDeadline       bool // fail reads when the read deadline passed
 }
 
 func (t *testNetConn) Read(b []byte) (int, error) {
 	t.readCalled++
 
+	if t.expireReadDeadline && !t.setReadDeadlineTime.IsZero() && time.Now().After(t.setReadDeadlineTime) {
+		return 0, &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	}
 	return 0, t.readError
 }
 
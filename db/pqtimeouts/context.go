@@ -0,0 +1,35 @@
+package pqtimeouts
+
+import (
+	"context"
+	"time"
+)
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type timeoutContextKey int
+
+const (
+	readTimeoutContextKey timeoutContextKey = iota
+	writeTimeoutContextKey
+)
+
+// WithReadTimeout returns a new Context carrying read timeout overriding read_timeout of the connection
+// for statements executed with the context. Zero timeout disables the read timeout.
+func WithReadTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, readTimeoutContextKey, timeout)
+}
+
+// WithWriteTimeout returns a new Context carrying write timeout overriding write_timeout of the connection
+// for statements executed with the context. Zero timeout disables the write timeout.
+func WithWriteTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, writeTimeoutContextKey, timeout)
+}
+
+// statementFromContext returns statement settings carried by the context.
+func statementFromContext(ctx context.Context) (stmt statement) {
+	stmt.deadline, _ = ctx.Deadline()
+	stmt.readTimeout, stmt.hasReadTimeout = ctx.Value(readTimeoutContextKey).(time.Duration)
+	stmt.writeTimeout, stmt.hasWriteTimeout = ctx.Value(writeTimeoutContextKey).(time.Duration)
+	return
+}
@@ -1,56 +1,160 @@
 package pqtimeouts
 
 import (
+	"context"
+	"math/rand"
 	"net"
 	"time"
 )
 
 // TimeoutDialer is an alternative to pq's defaultDialer.
 type TimeoutDialer struct {
-	netDial        func(string, string) (net.Conn, error)                // Allow this to be stubbed for testing
-	netDialTimeout func(string, string, time.Duration) (net.Conn, error) // Allow this to be stubbed for testing
+	netDial        func(string, string) (net.Conn, error)                  // Allow this to be stubbed for testing
+	netDialTimeout func(string, string, time.Duration) (net.Conn, error)   // Allow this to be stubbed for testing
+	netDialContext func(context.Context, string, string) (net.Conn, error) // Allow this to be stubbed for testing
 	readTimeout    time.Duration
 	writeTimeout   time.Duration
+	maxConnAge     time.Duration
+
+	// ctx and conn are set on dialers of a single connection, see forConnection.
+	ctx  context.Context
+	conn *timeoutConn
 }
 
 // NewTimeoutDialer creates a new dialer.
+// pq-timeouts parameters are removed from the returned connection string.
 func NewTimeoutDialer(connectionString string) (d *TimeoutDialer, newConnectionString string, err error) {
+	settings, newConnectionString, err := parseConnectionString(connectionString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// dial_timeout is used when pq dials without connect_timeout
+	nd := &net.Dialer{Timeout: settings.dialTimeout}
+	if settings.hasKeepAlive {
+		nd.KeepAlive = settings.keepAlive
+		if nd.KeepAlive == 0 {
+			nd.KeepAlive = -1 // zero keepalive disables keep-alive probes
+		}
+	}
+	if settings.tcpUserTimeout > 0 {
+		nd.Control = tcpUserTimeoutControl(settings.tcpUserTimeout)
+	}
+
 	d = &TimeoutDialer{
-		netDial:        net.Dial,
-		netDialTimeout: net.DialTimeout,
+		netDial: nd.Dial,
+		netDialTimeout: func(network string, address string, timeout time.Duration) (net.Conn, error) {
+			ndt := *nd
+			ndt.Timeout = timeout
+			return ndt.Dial(network, address)
+		},
+		netDialContext: nd.DialContext,
+		readTimeout:    settings.readTimeout,
+		writeTimeout:   settings.writeTimeout,
+		maxConnAge:     settings.maxConnAge,
 	}
-	d.readTimeout, d.writeTimeout, newConnectionString, err = parseConnectionString(connectionString)
 	return
 }
 
+// ReadTimeout returns the read timeout of connections dialed, zero if not set.
+func (t *TimeoutDialer) ReadTimeout() time.Duration {
+	return t.readTimeout
+}
+
+// WriteTimeout returns the write timeout of connections dialed, zero if not set.
+func (t *TimeoutDialer) WriteTimeout() time.Duration {
+	return t.writeTimeout
+}
+
+// forConnection returns a copy of the dialer used to open a single connection.
+// The first dial of the returned dialer is bound by the context and its connection
+// is kept to let the driver tighten deadlines of statements. Following dials
+// (pq dials a new connection to send cancel requests) behave as usual.
+func (t *TimeoutDialer) forConnection(ctx context.Context) *TimeoutDialer {
+	d := *t
+	d.ctx = ctx
+	d.conn = nil
+	return &d
+}
+
 // Dial implements pq.Dialer.
 func (t *TimeoutDialer) Dial(network string, address string) (net.Conn, error) {
+	if t.ctx != nil && t.conn == nil {
+		return t.dialConnection(network, address, 0)
+	}
+
 	c, err := t.netDial(network, address)
 	if err != nil {
 		return nil, err
 	}
 
-	// If we don't have any timeouts set, just return a normal connection.
-	if t.readTimeout == 0 && t.writeTimeout == 0 {
-		return c, nil
-	}
-
-	// Otherwise we want a timeoutConn to handle the read and write deadlines for us.
-	return &timeoutConn{conn: c, readTimeout: t.readTimeout, writeTimeout: t.writeTimeout}, nil
+	return t.wrap(c), nil
 }
 
 // DialTimeout implements pq.Dialer.
 func (t *TimeoutDialer) DialTimeout(network string, address string, timeout time.Duration) (net.Conn, error) {
+	if t.ctx != nil && t.conn == nil {
+		return t.dialConnection(network, address, timeout)
+	}
+
 	c, err := t.netDialTimeout(network, address, timeout)
 	if err != nil {
 		return nil, err
 	}
 
+	return t.wrap(c), nil
+}
+
+// wrap wraps the connection dialed directly into timeoutConn. Without a pool retiring the connection,
+// it's closed on the first write after max_conn_age.
+func (t *TimeoutDialer) wrap(c net.Conn) net.Conn {
 	// If we don't have any timeouts set, just return a normal connection.
-	if t.readTimeout == 0 && t.writeTimeout == 0 {
-		return c, nil
+	if t.readTimeout == 0 && t.writeTimeout == 0 && t.maxConnAge == 0 {
+		return c
 	}
 
 	// Otherwise we want a timeoutConn to handle the read and write deadlines for us.
-	return &timeoutConn{conn: c, readTimeout: t.readTimeout, writeTimeout: t.writeTimeout}, nil
+	tc := t.newConn(c)
+	tc.closeExpired = true
+	return tc
+}
+
+// newConn returns timeoutConn of the connection with timeouts and the maximum age of the dialer.
+func (t *TimeoutDialer) newConn(c net.Conn) *timeoutConn {
+	tc := &timeoutConn{conn: c, readTimeout: t.readTimeout, writeTimeout: t.writeTimeout}
+	if t.maxConnAge > 0 {
+		tc.expiresAt = time.Now().Add(jitterAge(t.maxConnAge))
+	}
+	return tc
+}
+
+// dialConnection dials the connection of the per connection dialer. The connection is always wrapped
+// into timeoutConn, and the context deadline is set as the statement deadline to bound connection startup.
+func (t *TimeoutDialer) dialConnection(network string, address string, timeout time.Duration) (net.Conn, error) {
+	ctx := t.ctx
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	c, err := t.netDialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connection is retired by the pool once it reaches max_conn_age, see driverConn.ResetSession
+	tc := t.newConn(c)
+	if deadline, ok := t.ctx.Deadline(); ok {
+		tc.setStatement(statement{deadline: deadline})
+	}
+	t.conn = tc
+
+	return tc, nil
+}
+
+// jitterAge shortens the maximum connection age randomly by up to 10%, so connections opened together
+// are not retired all at once.
+func jitterAge(age time.Duration) time.Duration {
+	return age - time.Duration(rand.Int63n(int64(age)/10+1))
 }
@@ -1,11 +1,14 @@
 package pqtimeouts
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/monetha/mth-core/db/pqtimeouts/faultconn"
 )
 
 func TestDialNoTimeouts(t *testing.T) {
@@ -98,6 +101,36 @@ func TestDialWithWriteTimeout(t *testing.T) {
 	}
 }
 
+func TestDialWithMaxConnAge(t *testing.T) {
+	testConn := &testNetConn{}
+
+	testDial := func(network string, address string) (net.Conn, error) {
+		return testConn, nil
+	}
+
+	dialer := TimeoutDialer{netDial: testDial, maxConnAge: 50 * time.Millisecond}
+
+	conn, err := dialer.Dial("testNetwork", "testAddress")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := conn.Write([]byte("query")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// connections dialed directly are closed on the first write after max_conn_age
+	n, err := conn.Write([]byte("query"))
+	if n != 0 || !errors.Is(err, ErrConnExpired) {
+		t.Errorf("Expected ErrConnExpired, got %d, %v", n, err)
+	}
+	if testConn.writeCalled != 1 || testConn.closeCalled != 1 {
+		t.Errorf("Expected the connection closed without writing, writes %d, closes %d", testConn.writeCalled, testConn.closeCalled)
+	}
+}
+
 func TestDialError(t *testing.T) {
 	testConn := &testNetConn{}
 
@@ -251,3 +284,32 @@ func TestDialTimeoutError(t *testing.T) {
 		t.Error("Connection should be nil")
 	}
 }
+
+func TestDialWithFaults(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	d, _, err := NewTimeoutDialer("host=localhost read_timeout=10ms")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	faults := faultconn.New()
+	c := &connector{dialer: d}
+	WrapDialContext(faults.DialContext)(c)
+
+	conn, err := c.dialer.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	faults.Set(faultconn.Faults{Stall: true})
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("The stalled read should time out: %v", err)
+	}
+}
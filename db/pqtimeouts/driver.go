@@ -1,8 +1,11 @@
 package pqtimeouts
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"net"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -15,11 +18,103 @@ type timeoutDriver struct {
 	dialOpen func(pq.Dialer, string) (driver.Conn, error) // Allow this to be stubbed for testing
 }
 
+// Open implements driver.Driver.
 func (t timeoutDriver) Open(connectionString string) (_ driver.Conn, err error) {
+	c, err := t.OpenConnector(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Connect(context.Background())
+}
+
+// OpenConnector implements driver.DriverContext.
+func (t timeoutDriver) OpenConnector(connectionString string) (driver.Connector, error) {
 	dialer, newConnectionString, err := NewTimeoutDialer(connectionString)
 	if err != nil {
 		return nil, err
 	}
 
-	return t.dialOpen(dialer, newConnectionString)
+	return &connector{driver: t, dialer: dialer, connectionString: newConnectionString}, nil
+}
+
+// ConnectorOption configures the connector returned by NewConnector.
+type ConnectorOption func(c *connector)
+
+// WithDialContext replaces the function dialing TCP connections of the connector.
+// Read and write timeouts are applied on top of connections it returns, but dial_timeout, keepalive
+// and tcp_user_timeout parameters are not, use WrapDialContext to keep them.
+func WithDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) ConnectorOption {
+	return func(c *connector) {
+		c.dialer.netDialContext = dial
+		c.dialer.netDial = func(network string, address string) (net.Conn, error) {
+			return dial(context.Background(), network, address)
+		}
+		c.dialer.netDialTimeout = func(network string, address string, timeout time.Duration) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return dial(ctx, network, address)
+		}
+	}
+}
+
+// WrapDialContext wraps the function dialing TCP connections of the connector, e.g. to inject faults in tests
+// with faultconn.Injector.DialContext. Connections are dialed with dial_timeout, keepalive and tcp_user_timeout
+// parameters of the connection string as usual, and read and write timeouts are applied on top of the wrapped ones.
+func WrapDialContext(wrap func(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error)) ConnectorOption {
+	return func(c *connector) {
+		netDial, netDialTimeout := c.dialer.netDial, c.dialer.netDialTimeout
+		c.dialer.netDialContext = wrap(c.dialer.netDialContext)
+		c.dialer.netDial = func(network string, address string) (net.Conn, error) {
+			return wrap(func(context.Context, string, string) (net.Conn, error) {
+				return netDial(network, address)
+			})(context.Background(), network, address)
+		}
+		c.dialer.netDialTimeout = func(network string, address string, timeout time.Duration) (net.Conn, error) {
+			return wrap(func(context.Context, string, string) (net.Conn, error) {
+				return netDialTimeout(network, address, timeout)
+			})(context.Background(), network, address)
+		}
+	}
+}
+
+// NewConnector returns a connector for the pq-timeouts driver with the given connection string.
+// The returned connector is intended to be used with database/sql.OpenDB.
+func NewConnector(connectionString string, opts ...ConnectorOption) (driver.Connector, error) {
+	c, err := timeoutDriver{dialOpen: pq.DialOpen}.OpenConnector(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		opt(c.(*connector))
+	}
+	return c, nil
+}
+
+type connector struct {
+	driver           timeoutDriver
+	dialer           *TimeoutDialer
+	connectionString string // connection string without pq-timeouts parameters
+	hooks            []Hooks
+}
+
+// Connect implements driver.Connector. The context bounds dialing and connection startup.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dialer := c.dialer.forConnection(ctx)
+
+	conn, err := c.driver.dialOpen(dialer, c.connectionString)
+	if err != nil || conn == nil || dialer.conn == nil {
+		return conn, err
+	}
+
+	// the context deadline was applied to connection startup only
+	dialer.conn.setStatement(statement{})
+
+	return &driverConn{Conn: conn, tc: dialer.conn, hooks: c.hooks}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *connector) Driver() driver.Driver {
+	return c.driver
 }
@@ -0,0 +1,250 @@
+package pqtimeouts
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+)
+
+// driverConn wraps pq connection and applies statement settings carried by the statement context:
+// the context deadline, which tightens the configured read and write timeouts when it comes earlier,
+// and timeouts overridden with WithReadTimeout and WithWriteTimeout.
+// Queries and execs are run with hooks of the connector.
+type driverConn struct {
+	driver.Conn
+	tc    *timeoutConn
+	hooks []Hooks
+}
+
+// beginStatement applies the statement settings of the context to the connection.
+// Settings of queries stay in effect until the rows are closed, so reading rows is bounded by them too,
+// other statements restore the connection defaults with endStatement once they're done.
+func (c *driverConn) beginStatement(ctx context.Context) {
+	c.tc.setStatement(statementFromContext(ctx))
+}
+
+// endStatement restores the connection defaults.
+func (c *driverConn) endStatement() {
+	c.tc.setStatement(statement{})
+}
+
+// QueryContext implements driver.QueryerContext.
+func (c *driverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return runHooks(ctx, c.hooks, query, len(args), func(ctx context.Context) (driver.Rows, error) {
+		c.beginStatement(ctx)
+		return c.wrapRows(q.QueryContext(ctx, query, args))
+	})
+}
+
+// ExecContext implements driver.ExecerContext.
+func (c *driverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return runHooks(ctx, c.hooks, query, len(args), func(ctx context.Context) (driver.Result, error) {
+		c.beginStatement(ctx)
+		defer c.endStatement()
+		return e.ExecContext(ctx, query, args)
+	})
+}
+
+// BeginTx implements driver.ConnBeginTx.
+func (c *driverConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.beginStatement(ctx)
+	defer c.endStatement()
+	var (
+		tx  driver.Tx
+		err error
+	)
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &driverTx{Tx: tx, conn: c}, nil
+}
+
+// PrepareContext implements driver.ConnPrepareContext.
+func (c *driverConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.beginStatement(ctx)
+	defer c.endStatement()
+	st, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &driverStmt{Stmt: st, conn: c, query: query}, nil
+}
+
+// wrapRows wraps rows of a query to restore the connection defaults when they're closed,
+// the defaults are restored right away when the query fails.
+func (c *driverConn) wrapRows(rows driver.Rows, err error) (driver.Rows, error) {
+	if err != nil {
+		c.endStatement()
+		return nil, err
+	}
+	return &driverRows{Rows: rows, conn: c}, nil
+}
+
+// ResetSession implements driver.SessionResetter. It restores the connection defaults
+// left by the last statement before the connection is reused, and retires connections
+// reached max_conn_age.
+func (c *driverConn) ResetSession(ctx context.Context) error {
+	c.endStatement()
+	if c.tc.expired(time.Now()) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator. Connections reached max_conn_age are not returned to the pool.
+func (c *driverConn) IsValid() bool {
+	return !c.tc.expired(time.Now())
+}
+
+// Close restores the connection defaults to let the connection terminate gracefully.
+func (c *driverConn) Close() error {
+	c.endStatement()
+	return c.Conn.Close()
+}
+
+// driverStmt wraps pq statement and applies statement settings carried by the statement context.
+type driverStmt struct {
+	driver.Stmt
+	conn  *driverConn
+	query string
+}
+
+// ExecContext implements driver.StmtExecContext.
+func (s *driverStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return runHooks(ctx, s.conn.hooks, s.query, len(args), func(ctx context.Context) (driver.Result, error) {
+		s.conn.beginStatement(ctx)
+		defer s.conn.endStatement()
+		return s.Stmt.Exec(values)
+	})
+}
+
+// QueryContext implements driver.StmtQueryContext.
+func (s *driverStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return runHooks(ctx, s.conn.hooks, s.query, len(args), func(ctx context.Context) (driver.Rows, error) {
+		s.conn.beginStatement(ctx)
+		return s.conn.wrapRows(s.Stmt.Query(values))
+	})
+}
+
+// driverTx wraps pq transaction and restores the connection defaults before COMMIT and ROLLBACK,
+// so they're not bounded by settings of the last query of the transaction.
+type driverTx struct {
+	driver.Tx
+	conn *driverConn
+}
+
+// Commit implements driver.Tx.
+func (tx *driverTx) Commit() error {
+	tx.conn.endStatement()
+	return tx.Tx.Commit()
+}
+
+// Rollback implements driver.Tx.
+func (tx *driverTx) Rollback() error {
+	tx.conn.endStatement()
+	return tx.Tx.Rollback()
+}
+
+// driverRows wraps pq rows and restores the connection defaults once the rows are closed.
+// Optional interfaces of pq rows are passed through.
+type driverRows struct {
+	driver.Rows
+	conn *driverConn
+}
+
+// Close implements driver.Rows. Closing reads the rest of the response, so the defaults are restored after it.
+func (r *driverRows) Close() error {
+	defer r.conn.endStatement()
+	return r.Rows.Close()
+}
+
+// HasNextResultSet implements driver.RowsNextResultSet.
+func (r *driverRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+// NextResultSet implements driver.RowsNextResultSet.
+func (r *driverRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.
+func (r *driverRows) ColumnTypeScanType(index int) reflect.Type {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return rs.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName.
+func (r *driverRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rs.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength.
+func (r *driverRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return rs.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.
+func (r *driverRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return rs.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale.
+func (r *driverRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return rs.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("pqtimeouts: driver does not support the use of Named Parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
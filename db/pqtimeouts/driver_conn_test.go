@@ -0,0 +1,302 @@
+package pqtimeouts
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type testDriverConn struct {
+	tc          *timeoutConn
+	queryCalled int
+}
+
+func (c *testDriverConn) Prepare(query string) (driver.Stmt, error) { return nil, nil }
+func (c *testDriverConn) Close() error                              { return nil }
+func (c *testDriverConn) Begin() (driver.Tx, error)                 { return &testTx{c: c}, nil }
+
+func (c *testDriverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.queryCalled++
+	// simulate reading the response
+	_, err := c.tc.Read(nil)
+	return &testRows{}, err
+}
+
+type testTx struct {
+	c *testDriverConn
+}
+
+func (tx *testTx) Commit() error {
+	// simulate reading the COMMIT response
+	_, err := tx.c.tc.Read(nil)
+	return err
+}
+
+func (tx *testTx) Rollback() error {
+	_, err := tx.c.tc.Read(nil)
+	return err
+}
+
+type testRows struct{}
+
+func (r *testRows) Columns() []string              { return nil }
+func (r *testRows) Close() error                   { return nil }
+func (r *testRows) Next(dest []driver.Value) error { return io.EOF }
+
+func newTestConnector(testConn *testNetConn, readTimeout time.Duration) (*connector, *testDriverConn) {
+	dc := &testDriverConn{}
+
+	testDialOpen := func(d pq.Dialer, name string) (driver.Conn, error) {
+		c, err := d.Dial("tcp", "localhost:5432")
+		if err != nil {
+			return nil, err
+		}
+		dc.tc = c.(*timeoutConn)
+		// simulate reading the startup response
+		_, err = c.Read(nil)
+		return dc, err
+	}
+
+	testDialContext := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return testConn, nil
+	}
+
+	return &connector{
+		driver: timeoutDriver{dialOpen: testDialOpen},
+		dialer: &TimeoutDialer{netDialContext: testDialContext, readTimeout: readTimeout},
+	}, dc
+}
+
+func TestConnectContextDeadline(t *testing.T) {
+	testConn := &testNetConn{}
+	c, _ := newTestConnector(testConn, 0)
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := conn.(*driverConn); !ok {
+		t.Errorf("The connection is not a *driverConn")
+	}
+
+	if testConn.setReadDeadlineTimePrev != deadline {
+		t.Errorf("Startup read deadline was not set to the context deadline: %v", testConn.setReadDeadlineTimePrev)
+	}
+
+	if !conn.(*driverConn).tc.stmt.deadline.IsZero() {
+		t.Error("Statement deadline was not cleared after startup")
+	}
+}
+
+func TestQueryContextTightensReadTimeout(t *testing.T) {
+	testConn := &testNetConn{}
+	c, dc := newTestConnector(testConn, time.Hour)
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	_, err = conn.(driver.QueryerContext).QueryContext(ctx, "SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if dc.queryCalled != 1 {
+		t.Errorf("Query was not called")
+	}
+
+	if testConn.setReadDeadlineTimePrev != deadline {
+		t.Errorf("Read deadline was not tightened to the context deadline: %v", testConn.setReadDeadlineTimePrev)
+	}
+
+	// a statement without deadline uses the read timeout
+	_, err = conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !testConn.setReadDeadlineTimePrev.After(time.Now().Add(time.Hour - time.Minute)) {
+		t.Errorf("Read deadline was not set by the read timeout: %v", testConn.setReadDeadlineTimePrev)
+	}
+}
+
+func TestQuerySettingsRestoredBeforeCommit(t *testing.T) {
+	testConn := &testNetConn{expireReadDeadline: true}
+	c, dc := newTestConnector(testConn, time.Hour)
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctx = WithReadTimeout(ctx, time.Millisecond)
+
+	tx, err := conn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rows, err := conn.(driver.QueryerContext).QueryContext(ctx, "SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dc.tc.stmt == (statement{}) {
+		t.Error("Statement settings should stay in effect until the rows are closed")
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dc.tc.stmt != (statement{}) {
+		t.Errorf("Statement settings were not restored when the rows were closed: %+v", dc.tc.stmt)
+	}
+
+	// rows of the last query are not closed before COMMIT
+	if _, err := conn.(driver.QueryerContext).QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := tx.Commit(); err != nil {
+		t.Errorf("COMMIT should run with the connection defaults: %v", err)
+	}
+}
+
+func TestConnectorDialsCancelRequestWithoutContext(t *testing.T) {
+	d := (&TimeoutDialer{
+		netDial: func(network string, address string) (net.Conn, error) {
+			return &testNetConn{}, nil
+		},
+		netDialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return &testNetConn{}, nil
+		},
+	}).forConnection(context.Background())
+
+	first, _ := d.Dial("tcp", "localhost:5432")
+	second, _ := d.Dial("tcp", "localhost:5432")
+
+	if d.conn != first {
+		t.Error("The first connection was not kept")
+	}
+
+	if _, ok := second.(*testNetConn); !ok {
+		t.Error("The cancel request connection should not be wrapped without timeouts")
+	}
+}
+
+func (c *testDriverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	// simulate reading the response
+	_, err := c.tc.Read(nil)
+	return nil, err
+}
+
+func TestExecContextTimeoutOverride(t *testing.T) {
+	testConn := &testNetConn{}
+	c, dc := newTestConnector(testConn, time.Hour)
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx := WithReadTimeout(context.Background(), time.Second)
+	start := time.Now()
+	_, err = conn.(driver.ExecerContext).ExecContext(ctx, "UPDATE t SET a = 1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if d := testConn.setReadDeadlineTimePrev.Sub(start); d < time.Second || d > time.Minute {
+		t.Errorf("Read deadline was not set by the overridden read timeout: %v", d)
+	}
+
+	if dc.tc.stmt != (statement{}) {
+		t.Errorf("Statement settings were not restored: %+v", dc.tc.stmt)
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	opErr := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	testConn := &testNetConn{readError: opErr}
+
+	conn := &timeoutConn{conn: testConn, readTimeout: time.Second}
+	_, err := conn.Read(nil)
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("The error should match ErrTimeout: %v", err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("The read timeout error should not match context.DeadlineExceeded: %v", err)
+	}
+
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Op != "read" || te.Duration != time.Second {
+		t.Errorf("The error should be a TimeoutError: %v", err)
+	}
+
+	if _, ok := err.(*net.OpError); !ok {
+		t.Errorf("The error should stay *net.OpError: %T", err)
+	}
+
+	conn.setStatement(statement{deadline: time.Now().Add(time.Millisecond)})
+	_, err = conn.Read(nil)
+
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("The statement deadline error should match ErrTimeout and context.DeadlineExceeded: %v", err)
+	}
+
+	testConn.readError = fmt.Errorf("connection reset")
+	_, err = conn.Read(nil)
+
+	if errors.Is(err, ErrTimeout) {
+		t.Errorf("The error should not match ErrTimeout: %v", err)
+	}
+}
+
+func TestMaxConnAge(t *testing.T) {
+	testConn := &testNetConn{}
+	c, dc := newTestConnector(testConn, 0)
+	c.dialer.maxConnAge = time.Hour
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if age := time.Until(dc.tc.expiresAt); age > time.Hour || age < 50*time.Minute {
+		t.Errorf("The connection expiration was not as expected: %v", age)
+	}
+
+	if err := conn.(driver.SessionResetter).ResetSession(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	dc.tc.expiresAt = time.Now()
+	if conn.(driver.Validator).IsValid() {
+		t.Error("The expired connection should not be valid")
+	}
+	if err := conn.(driver.SessionResetter).ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Errorf("The expired connection should be retired: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package pqtimeouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is matched by errors.Is for all read and write timeouts of the driver.
+var ErrTimeout = errors.New("pqtimeouts: timeout")
+
+// ErrConnExpired is the error of writes to a connection dialed by TimeoutDialer.Dial or DialTimeout directly,
+// e.g. by pq.NewDialListener, after it reached max_conn_age. The connection is closed.
+var ErrConnExpired = errors.New("pqtimeouts: connection reached max_conn_age")
+
+// TimeoutError is the error of a read or write exceeding its timeout or the statement deadline.
+// Errors returned by the driver wrap it, use errors.Is(err, ErrTimeout) or errors.As to check for it.
+// Timeouts caused by the statement context deadline match context.DeadlineExceeded as well.
+type TimeoutError struct {
+	Op       string        // "read" or "write"
+	Duration time.Duration // exceeded timeout, zero when the statement deadline was exceeded
+	Err      error         // underlying network error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Duration == 0 {
+		return fmt.Sprintf("pqtimeouts: %s deadline exceeded: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("pqtimeouts: %s timeout of %v exceeded: %v", e.Op, e.Duration, e.Err)
+}
+
+// Unwrap returns the underlying network error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches ErrTimeout, or context.DeadlineExceeded for statement deadlines.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || (e.Duration == 0 && target == context.DeadlineExceeded)
+}
+
+// Timeout implements net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary implements net.Error.
+func (e *TimeoutError) Temporary() bool {
+	return false
+}
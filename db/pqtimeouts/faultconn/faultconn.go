@@ -0,0 +1,350 @@
+// Package faultconn injects network faults into database connections, to test timeout and retry
+// handling of services against a local Postgres.
+//
+// Connections are wrapped below pq-timeouts, so injected latency and stalls trip read and write timeouts.
+// They're dialed by pq-timeouts as usual, with keepalive and tcp_user_timeout of the connection string:
+//
+//	faults := faultconn.New()
+//	connector, err := pqtimeouts.NewConnector(dsn, pqtimeouts.WrapDialContext(faults.DialContext))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	db := sql.OpenDB(connector)
+//
+//	faults.Set(faultconn.Faults{Stall: true}) // queries fail with pqtimeouts.ErrTimeout
+//	faults.Set(faultconn.Faults{})            // back to normal
+//	faults.ResetAll()                         // open connections fail with connection reset
+//
+// Faults can be changed at any time and apply to all connections of the injector.
+package faultconn
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Faults are faults injected into connections. Zero value injects no faults.
+type Faults struct {
+	// Latency delays each read and write.
+	Latency time.Duration
+
+	// Stall blocks reads until the read deadline passes or the connection is closed, as if the server hung.
+	Stall bool
+
+	// PartialWrites writes only the first half of each write before failing it with connection reset.
+	PartialWrites bool
+
+	// ResetAfterBytes resets the connection after the number of bytes read and written. Zero disables the fault.
+	ResetAfterBytes int64
+
+	// DropAfterBytes silently drops the connection after the number of bytes read and written: writes
+	// are discarded and reads stall, as if a NAT gateway forgot the connection. Zero disables the fault.
+	DropAfterBytes int64
+}
+
+// Injector injects faults into connections it wraps.
+type Injector struct {
+	mu     sync.Mutex
+	faults Faults
+	conns  map[*Conn]struct{}
+	change chan struct{} // closed and replaced when faults change, wakes up stalled reads
+}
+
+// New creates an injector injecting no faults until Set is called.
+func New() *Injector {
+	return &Injector{
+		conns:  make(map[*Conn]struct{}),
+		change: make(chan struct{}),
+	}
+}
+
+// Set replaces faults injected into all connections.
+func (i *Injector) Set(f Faults) {
+	i.mu.Lock()
+	i.faults = f
+	i.wake()
+	i.mu.Unlock()
+}
+
+// wake wakes up stalled reads to check faults again, the caller must hold i.mu.
+func (i *Injector) wake() {
+	close(i.change)
+	i.change = make(chan struct{})
+}
+
+// ResetAll resets all open connections: their pending and following reads and writes fail with connection reset,
+// including reads blocked waiting for data.
+func (i *Injector) ResetAll() {
+	i.mu.Lock()
+	conns := make([]*Conn, 0, len(i.conns))
+	for c := range i.conns {
+		conns = append(conns, c)
+	}
+	i.mu.Unlock()
+
+	for _, c := range conns {
+		c.reset()
+	}
+}
+
+// Conns returns the number of open connections.
+func (i *Injector) Conns() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.conns)
+}
+
+func (i *Injector) state() (Faults, <-chan struct{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.faults, i.change
+}
+
+// Wrap wraps the connection to inject faults into it.
+func (i *Injector) Wrap(c net.Conn) *Conn {
+	fc := &Conn{Conn: c, i: i, closed: make(chan struct{})}
+	i.mu.Lock()
+	i.conns[fc] = struct{}{}
+	i.mu.Unlock()
+	return fc
+}
+
+// DialContext returns a dial function wrapping connections dialed with dial, net.Dialer is used when dial is nil.
+func (i *Injector) DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		c, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return i.Wrap(c), nil
+	}
+}
+
+// Conn is a connection with injected faults.
+type Conn struct {
+	net.Conn
+	i *Injector
+
+	mu            sync.Mutex
+	transferred   int64
+	isReset       bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closeOnce     sync.Once
+	closed        chan struct{}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(b []byte) (int, error) {
+	f, err := c.before("read", false)
+	if err != nil {
+		return 0, err
+	}
+
+	if f.Stall || c.dropped(f) {
+		if err := c.stall(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.Conn.Read(b)
+	c.count(n)
+	return n, c.resetError("read", err)
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(b []byte) (int, error) {
+	f, err := c.before("write", true)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.dropped(f) {
+		return len(b), nil
+	}
+
+	if f.PartialWrites && len(b) > 1 {
+		n, err := c.Conn.Write(b[:len(b)/2])
+		c.count(n)
+		if err != nil {
+			return n, err
+		}
+		c.reset()
+		return n, c.opError("write", syscall.ECONNRESET)
+	}
+
+	n, err := c.Conn.Write(b)
+	c.count(n)
+	return n, c.resetError("write", err)
+}
+
+// before applies faults taking effect before a read or write: reset and latency.
+func (c *Conn) before(op string, write bool) (Faults, error) {
+	f, _ := c.i.state()
+
+	c.mu.Lock()
+	if f.ResetAfterBytes > 0 && c.transferred >= f.ResetAfterBytes {
+		c.isReset = true
+	}
+	isReset := c.isReset
+	deadline := c.readDeadline
+	if write {
+		deadline = c.writeDeadline
+	}
+	c.mu.Unlock()
+
+	if isReset {
+		return f, c.opError(op, syscall.ECONNRESET)
+	}
+
+	if f.Latency > 0 {
+		if !c.sleep(f.Latency, deadline) {
+			return f, c.opError(op, os.ErrDeadlineExceeded)
+		}
+	}
+
+	return f, nil
+}
+
+// sleep waits for the duration and reports whether it finished before the deadline.
+func (c *Conn) sleep(d time.Duration, deadline time.Time) bool {
+	if !deadline.IsZero() && time.Until(deadline) < d {
+		time.Sleep(time.Until(deadline))
+		return false
+	}
+	time.Sleep(d)
+	return true
+}
+
+// stall blocks until the read deadline passes, the connection is closed or reset, or faults change
+// so the read is not stalled anymore, nil is returned in the last case.
+func (c *Conn) stall() error {
+	for {
+		f, change := c.i.state()
+
+		c.mu.Lock()
+		deadline := c.readDeadline
+		isReset := c.isReset
+		c.mu.Unlock()
+
+		switch {
+		case isReset:
+			return c.opError("read", syscall.ECONNRESET)
+		case !f.Stall && !c.dropped(f):
+			return nil
+		}
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+			err     error
+		)
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		select {
+		case <-timeout:
+			err = c.opError("read", os.ErrDeadlineExceeded)
+		case <-c.closed:
+			err = c.opError("read", net.ErrClosed)
+		case <-change:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Conn) dropped(f Faults) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return f.DropAfterBytes > 0 && c.transferred >= f.DropAfterBytes
+}
+
+func (c *Conn) count(n int) {
+	c.mu.Lock()
+	c.transferred += int64(n)
+	c.mu.Unlock()
+}
+
+// reset marks the connection reset, wakes up stalled reads, and interrupts reads and writes
+// blocked on the wrapped connection by setting a past deadline.
+func (c *Conn) reset() {
+	c.mu.Lock()
+	c.isReset = true
+	c.mu.Unlock()
+
+	c.i.mu.Lock()
+	c.i.wake()
+	c.i.mu.Unlock()
+
+	_ = c.Conn.SetDeadline(time.Unix(1, 0))
+}
+
+// resetError replaces the error of the wrapped connection with connection reset when the connection was reset.
+func (c *Conn) resetError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	isReset := c.isReset
+	c.mu.Unlock()
+
+	if isReset {
+		return c.opError(op, syscall.ECONNRESET)
+	}
+	return err
+}
+
+func (c *Conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "tcp", Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: err}
+}
+
+// Close implements net.Conn.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.i.mu.Lock()
+		delete(c.i.conns, c)
+		c.i.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// SetDeadline implements net.Conn.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
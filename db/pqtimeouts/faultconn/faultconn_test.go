@@ -0,0 +1,168 @@
+package faultconn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes everything received on connections it accepts.
+func echoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, i *Injector) net.Conn {
+	c, err := i.DialContext(nil)(context.Background(), "tcp", echoServer(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func echo(c net.Conn, s string) (string, error) {
+	if _, err := c.Write([]byte(s)); err != nil {
+		return "", err
+	}
+	b := make([]byte, len(s))
+	_, err := io.ReadFull(c, b)
+	return string(b), err
+}
+
+func TestNoFaults(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	c := dial(t, i)
+	r.Equal(1, i.Conns())
+
+	s, err := echo(c, "ping")
+	r.NoError(err)
+	r.Equal("ping", s)
+
+	r.NoError(c.Close())
+	r.Equal(0, i.Conns())
+}
+
+func TestLatency(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	c := dial(t, i)
+	i.Set(Faults{Latency: 20 * time.Millisecond})
+
+	start := time.Now()
+	_, err := echo(c, "ping")
+	r.NoError(err)
+	r.GreaterOrEqual(time.Since(start), 40*time.Millisecond)
+
+	r.NoError(c.SetReadDeadline(time.Now().Add(5 * time.Millisecond)))
+	_, err = c.Read(make([]byte, 1))
+	r.True(errors.Is(err, os.ErrDeadlineExceeded))
+}
+
+func TestStall(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	c := dial(t, i)
+	i.Set(Faults{Stall: true})
+
+	_, err := c.Write([]byte("ping"))
+	r.NoError(err)
+
+	r.NoError(c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)))
+	_, err = c.Read(make([]byte, 4))
+	var ne net.Error
+	r.True(errors.As(err, &ne) && ne.Timeout())
+
+	// the stalled read continues when the fault is removed
+	r.NoError(c.SetReadDeadline(time.Time{}))
+	time.AfterFunc(10*time.Millisecond, func() { i.Set(Faults{}) })
+	b := make([]byte, 4)
+	_, err = io.ReadFull(c, b)
+	r.NoError(err)
+	r.Equal("ping", string(b))
+}
+
+func TestResetAll(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	c := dial(t, i)
+	i.Set(Faults{Stall: true})
+
+	time.AfterFunc(10*time.Millisecond, i.ResetAll)
+	_, err := c.Read(make([]byte, 1))
+	r.True(errors.Is(err, syscall.ECONNRESET))
+
+	_, err = c.Write([]byte("ping"))
+	r.True(errors.Is(err, syscall.ECONNRESET))
+
+	// reads blocked waiting for data are interrupted too
+	c = dial(t, i)
+	i.Set(Faults{})
+	time.AfterFunc(10*time.Millisecond, i.ResetAll)
+	_, err = c.Read(make([]byte, 1))
+	r.True(errors.Is(err, syscall.ECONNRESET))
+}
+
+func TestPartialWrites(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	c := dial(t, i)
+	i.Set(Faults{PartialWrites: true})
+
+	n, err := c.Write([]byte("ping"))
+	r.Equal(2, n)
+	r.True(errors.Is(err, syscall.ECONNRESET))
+}
+
+func TestResetAndDropAfterBytes(t *testing.T) {
+	r := require.New(t)
+
+	i := New()
+	i.Set(Faults{ResetAfterBytes: 8})
+	c := dial(t, i)
+
+	_, err := echo(c, "ping")
+	r.NoError(err)
+	_, err = echo(c, "ping")
+	r.True(errors.Is(err, syscall.ECONNRESET))
+
+	i.Set(Faults{DropAfterBytes: 8})
+	c = dial(t, i)
+
+	_, err = echo(c, "ping")
+	r.NoError(err)
+	n, err := c.Write([]byte("ping"))
+	r.NoError(err)
+	r.Equal(4, n)
+
+	r.NoError(c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)))
+	_, err = c.Read(make([]byte, 4))
+	r.True(errors.Is(err, os.ErrDeadlineExceeded))
+}
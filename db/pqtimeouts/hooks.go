@@ -0,0 +1,122 @@
+package pqtimeouts
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/monetha/mth-core/data/metrics"
+	"github.com/monetha/mth-core/log"
+	"go.uber.org/zap"
+)
+
+// Query is a query executed by the driver, passed to hooks.
+type Query struct {
+	// SQL is the query text.
+	SQL string
+
+	// Args is the number of query arguments. Argument values aren't passed to hooks as they may contain personal data.
+	Args int
+
+	// Duration is the time the query took. It's set for AfterQuery only.
+	// Rows of queries returning rows are read after the query, so reading is not included.
+	Duration time.Duration
+
+	// Err is the error the query failed with. It's set for AfterQuery only.
+	Err error
+}
+
+// Hooks are called before and after each query or exec statement. Both functions are optional.
+type Hooks struct {
+	// BeforeQuery is called before the query, the returned context is passed to the query and AfterQuery.
+	BeforeQuery func(ctx context.Context, q *Query) context.Context
+
+	// AfterQuery is called after the query.
+	AfterQuery func(ctx context.Context, q *Query)
+}
+
+// WithHooks adds hooks called around queries of the connector. Hooks are called in the order given.
+func WithHooks(hooks ...Hooks) ConnectorOption {
+	return func(c *connector) {
+		c.hooks = append(c.hooks, hooks...)
+	}
+}
+
+// runHooks runs query f, calling hooks before and after it.
+func runHooks[T any](ctx context.Context, hooks []Hooks, sql string, args int, f func(ctx context.Context) (T, error)) (T, error) {
+	if len(hooks) == 0 {
+		return f(ctx)
+	}
+
+	q := &Query{SQL: sql, Args: args}
+	for _, h := range hooks {
+		if h.BeforeQuery != nil {
+			ctx = h.BeforeQuery(ctx, q)
+		}
+	}
+
+	start := time.Now()
+	res, err := f(ctx)
+	q.Duration = time.Since(start)
+	q.Err = err
+
+	for _, h := range hooks {
+		if h.AfterQuery != nil {
+			h.AfterQuery(ctx, q)
+		}
+	}
+
+	return res, err
+}
+
+// SlowQueryLog returns hooks logging queries taking at least threshold with warn level.
+// Fields carried by the context (see log.IntoContext), e.g. the correlation ID, are added to the log entry.
+func SlowQueryLog(threshold time.Duration) Hooks {
+	return Hooks{
+		AfterQuery: func(ctx context.Context, q *Query) {
+			if q.Duration < threshold {
+				return
+			}
+
+			l := log.FromContext(ctx).With(
+				zap.String("sql", q.SQL),
+				zap.Int("args", q.Args),
+				zap.Duration("duration", q.Duration),
+			)
+			if q.Err != nil {
+				l = l.With(log.Err(q.Err))
+			}
+			l.Warn("slow query")
+		},
+	}
+}
+
+// MetricsHooks returns hooks recording duration of queries into the timer registered with the given name.
+// Queries are counted by outcome as well: ok, error, timeout (including ErrTimeout) and canceled,
+// which gives error and timeout rates.
+func MetricsHooks(registry *metrics.Registry, name string) (Hooks, error) {
+	timer := metrics.NewTimer()
+	if err := registry.RegisterTimer(name, timer); err != nil {
+		return Hooks{}, err
+	}
+
+	return Hooks{
+		AfterQuery: func(ctx context.Context, q *Query) {
+			timer.UpdateOutcome(q.Duration, queryOutcome(ctx, q.Err))
+		},
+	}, nil
+}
+
+// queryOutcome returns timer outcome of the query error.
+func queryOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeOK
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded), ctx.Err() == context.DeadlineExceeded:
+		return metrics.OutcomeTimeout
+	case errors.Is(err, context.Canceled), ctx.Err() == context.Canceled:
+		return metrics.OutcomeCanceled
+	default:
+		return metrics.OutcomeError
+	}
+}
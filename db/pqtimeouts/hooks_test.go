@@ -0,0 +1,132 @@
+package pqtimeouts
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/monetha/mth-core/data/metrics"
+	webcontext "github.com/monetha/mth-core/web/context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testHookKey struct{}
+
+func TestHooks(t *testing.T) {
+	opErr := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	testConn := &testNetConn{}
+	c, _ := newTestConnector(testConn, time.Second)
+
+	var before, after []Query
+	WithHooks(Hooks{
+		BeforeQuery: func(ctx context.Context, q *Query) context.Context {
+			before = append(before, *q)
+			return context.WithValue(ctx, testHookKey{}, "value")
+		},
+		AfterQuery: func(ctx context.Context, q *Query) {
+			if ctx.Value(testHookKey{}) != "value" {
+				t.Error("The context returned by BeforeQuery was not passed to AfterQuery")
+			}
+			after = append(after, *q)
+		},
+	})(c)
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testConn.readError = opErr
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: "a"}}
+	_, err = conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT 1", args)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("The error was not as expected: %v", err)
+	}
+
+	if len(before) != 1 || before[0].SQL != "SELECT 1" || before[0].Args != 2 || before[0].Err != nil {
+		t.Errorf("BeforeQuery was not called as expected: %+v", before)
+	}
+
+	if len(after) != 1 || after[0].SQL != "SELECT 1" || after[0].Args != 2 || after[0].Err != err {
+		t.Errorf("AfterQuery was not called as expected: %+v", after)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	hooks := SlowQueryLog(time.Second)
+	ctx := webcontext.WithCorrelationID(context.Background(), "cid")
+
+	hooks.AfterQuery(ctx, &Query{SQL: "SELECT 1", Duration: time.Millisecond})
+	if logs.Len() != 0 {
+		t.Errorf("Fast query should not be logged: %v", logs.All())
+	}
+
+	hooks.AfterQuery(ctx, &Query{SQL: "SELECT 2", Args: 1, Duration: 2 * time.Second})
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Slow query was not logged: %v", entries)
+	}
+
+	fields := entries[0].ContextMap()
+	if fields["sql"] != "SELECT 2" || fields["correlation_id"] != "cid" || fields["duration"] != 2*time.Second {
+		t.Errorf("The log entry was not as expected: %v", fields)
+	}
+}
+
+func TestMetricsHooks(t *testing.T) {
+	preg := prometheus.NewRegistry()
+	reg := metrics.NewRegistry("db", metrics.WithRegisterer(preg), metrics.WithExpvarRoot(new(expvar.Map).Init()))
+
+	hooks, err := MetricsHooks(reg, "queries")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	timeoutErr := &net.OpError{Op: "read", Err: &TimeoutError{Op: "read", Duration: time.Second}}
+	hooks.AfterQuery(context.Background(), &Query{Duration: time.Millisecond})
+	hooks.AfterQuery(context.Background(), &Query{Duration: time.Millisecond, Err: errors.New("failed")})
+	hooks.AfterQuery(context.Background(), &Query{Duration: time.Second, Err: timeoutErr})
+
+	if n := testutil.CollectAndCount(preg, "db_queries_outcome_seconds"); n != 3 {
+		t.Errorf("The number of outcomes was not as expected: %d", n)
+	}
+
+	if _, err := MetricsHooks(reg, "queries"); err == nil {
+		t.Error("Expected error registering the timer twice")
+	}
+}
+
+func TestQueryOutcome(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx      context.Context
+		err      error
+		expected string
+	}{
+		{context.Background(), nil, metrics.OutcomeOK},
+		{context.Background(), errors.New("failed"), metrics.OutcomeError},
+		{context.Background(), &TimeoutError{Op: "read", Duration: time.Second}, metrics.OutcomeTimeout},
+		{context.Background(), context.DeadlineExceeded, metrics.OutcomeTimeout},
+		{canceled, errors.New("canceling statement due to user request"), metrics.OutcomeCanceled},
+	}
+
+	for _, tt := range tests {
+		if outcome := queryOutcome(tt.ctx, tt.err); outcome != tt.expected {
+			t.Errorf("The outcome of %v was not as expected: %q", tt.err, outcome)
+		}
+	}
+}
@@ -5,49 +5,259 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/lib/pq"
 )
 
-func parseConnectionString(connection string) (readTimeout time.Duration, writeTimeout time.Duration,
-	newConnectionString string, err error) {
+// redactedValue replaces sensitive values in redacted connection strings.
+const redactedValue = "xxxxx"
 
-	// Look for read_timeout and write_timeout in the connection string and extract the values.
-	// read_timeout and write_timeout need to be removed from the connection string before calling pq as well.
-	var newConnectionSettings []string
+// sensitiveKeys are the connection string parameters hidden by DSN.Redacted.
+var sensitiveKeys = map[string]struct{}{
+	"password":    {},
+	"sslpassword": {},
+}
+
+// DSN is a parsed libpq key/value connection string. Order of parameters is preserved.
+type DSN struct {
+	params []dsnParam
+}
+
+type dsnParam struct {
+	key   string
+	value string
+}
 
+// ParseDSN parses a libpq key/value connection string (e.g. "user=pqtest password='sec ret'")
+// or a postgres:// URL. Values may be single-quoted, backslash escapes quotes and backslashes.
+func ParseDSN(connectionString string) (*DSN, error) {
 	// If the connection is specified as a URL, use the parsing function in lib/pq to turn it into options.
-	if strings.HasPrefix(connection, "postgres://") || strings.HasPrefix(connection, "postgresql://") {
-		connection, err = pq.ParseURL(connection)
+	if strings.HasPrefix(connectionString, "postgres://") || strings.HasPrefix(connectionString, "postgresql://") {
+		var err error
+		connectionString, err = pq.ParseURL(connectionString)
 		if err != nil {
-			return
+			return nil, err
 		}
 	}
 
-	for _, setting := range strings.Fields(connection) {
-		s := strings.Split(setting, "=")
+	d := &DSN{}
+	s := []rune(connectionString)
+	i := 0
 
-		switch s[0] {
-		case "read_timeout":
-			val, err := strconv.Atoi(s[1])
-			if err != nil {
-				return 0, 0, "", fmt.Errorf("error interpreting value for read_timeout: %v", err)
-			}
-			readTimeout = time.Duration(val) * time.Millisecond // timeout is in milliseconds
+	skipSpaces := func() {
+		for i < len(s) && unicode.IsSpace(s[i]) {
+			i++
+		}
+	}
 
-		case "write_timeout":
-			val, err := strconv.Atoi(s[1])
-			if err != nil {
-				return 0, 0, "", fmt.Errorf("error interpreting value for write_timeout: %v", err)
+	for {
+		skipSpaces()
+		if i == len(s) {
+			return d, nil
+		}
+
+		// Scan the key
+		start := i
+		for i < len(s) && !unicode.IsSpace(s[i]) && s[i] != '=' {
+			i++
+		}
+		key := string(s[start:i])
+
+		skipSpaces()
+		if i == len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q in connection string", key)
+		}
+		i++
+		skipSpaces()
+
+		var value []rune
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for {
+				if i == len(s) {
+					return nil, fmt.Errorf("unterminated quoted string literal in connection string")
+				}
+				r := s[i]
+				i++
+				if r == '\'' {
+					break
+				}
+				if r == '\\' {
+					if i == len(s) {
+						return nil, fmt.Errorf("unterminated quoted string literal in connection string")
+					}
+					r = s[i]
+					i++
+				}
+				value = append(value, r)
 			}
-			writeTimeout = time.Duration(val) * time.Millisecond // timeout is in milliseconds
+		} else {
+			for i < len(s) && !unicode.IsSpace(s[i]) {
+				r := s[i]
+				i++
+				if r == '\\' {
+					if i == len(s) {
+						return nil, fmt.Errorf("missing character after backslash in connection string")
+					}
+					r = s[i]
+					i++
+				}
+				value = append(value, r)
+			}
+		}
+
+		d.params = append(d.params, dsnParam{key: key, value: string(value)})
+	}
+}
+
+// Get returns the value of the last parameter with the given key.
+func (d *DSN) Get(key string) (value string, ok bool) {
+	for _, p := range d.params {
+		if p.key == key {
+			value, ok = p.value, true
+		}
+	}
+	return
+}
+
+// Set sets the value of the parameter with the given key, adding the parameter if needed.
+func (d *DSN) Set(key, value string) {
+	for i := range d.params {
+		if d.params[i].key == key {
+			d.params[i].value = value
+			return
+		}
+	}
+	d.params = append(d.params, dsnParam{key: key, value: value})
+}
+
+// Delete removes all parameters with the given key.
+func (d *DSN) Delete(key string) {
+	params := d.params[:0]
+	for _, p := range d.params {
+		if p.key != key {
+			params = append(params, p)
+		}
+	}
+	d.params = params
+}
 
-		default:
-			newConnectionSettings = append(newConnectionSettings, setting)
+// String returns the connection string in libpq key/value format.
+func (d *DSN) String() string {
+	return d.format(false)
+}
+
+// Redacted returns the connection string with passwords replaced, it's safe to log.
+func (d *DSN) Redacted() string {
+	return d.format(true)
+}
+
+func (d *DSN) format(redact bool) string {
+	settings := make([]string, 0, len(d.params))
+	for _, p := range d.params {
+		value := p.value
+		if _, ok := sensitiveKeys[p.key]; ok && redact {
+			value = redactedValue
+		}
+		settings = append(settings, p.key+"="+quoteValue(value))
+	}
+	return strings.Join(settings, " ")
+}
+
+// quoteValue quotes the value if it's empty or contains whitespace, quotes or backslashes.
+func quoteValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\v\f'\\") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Redacted returns the connection string with passwords replaced, it's safe to log.
+// Connection strings which can't be parsed are replaced completely.
+func Redacted(connectionString string) string {
+	d, err := ParseDSN(connectionString)
+	if err != nil {
+		return redactedValue
+	}
+	return d.Redacted()
+}
+
+// parseDuration parses a duration given either as a Go duration string ("500ms", "2s")
+// or as a bare number of milliseconds.
+func parseDuration(value string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(value); err == nil {
+		if ms < 0 {
+			return 0, fmt.Errorf("negative duration %q", value)
+		}
+		return time.Duration(ms) * time.Millisecond, nil // bare values are in milliseconds
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", value)
+	}
+	return d, nil
+}
+
+// connectionSettings are the pq-timeouts parameters of a connection string.
+type connectionSettings struct {
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	dialTimeout  time.Duration
+
+	keepAlive    time.Duration
+	hasKeepAlive bool
+
+	tcpUserTimeout time.Duration
+	maxConnAge     time.Duration
+}
+
+// parseConnectionString extracts pq-timeouts parameters from the connection string. The returned
+// connection string doesn't contain them anymore and can be passed to pq.
+func parseConnectionString(connection string) (settings connectionSettings, newConnectionString string, err error) {
+	d, err := ParseDSN(connection)
+	if err != nil {
+		return
+	}
+
+	_, settings.hasKeepAlive = d.Get("keepalive")
+
+	durations := []struct {
+		key string
+		d   *time.Duration
+	}{
+		{"read_timeout", &settings.readTimeout},
+		{"write_timeout", &settings.writeTimeout},
+		{"dial_timeout", &settings.dialTimeout},
+		{"keepalive", &settings.keepAlive},
+		{"tcp_user_timeout", &settings.tcpUserTimeout},
+		{"max_conn_age", &settings.maxConnAge},
+	}
+	for _, p := range durations {
+		value, ok := d.Get(p.key)
+		if !ok {
+			continue
+		}
+		if *p.d, err = parseDuration(value); err != nil {
+			return connectionSettings{}, "", fmt.Errorf("error interpreting value for %s: %v", p.key, err)
+		}
+		d.Delete(p.key)
+	}
+
+	// statement_timeout is passed to the server as a run-time parameter, which is in milliseconds.
+	if value, ok := d.Get("statement_timeout"); ok {
+		timeout, err := parseDuration(value)
+		if err != nil {
+			return connectionSettings{}, "", fmt.Errorf("error interpreting value for statement_timeout: %v", err)
 		}
+		d.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
 	}
 
-	newConnectionString = strings.Join(newConnectionSettings, " ")
+	newConnectionString = d.String()
 
 	return
 }
@@ -0,0 +1,23 @@
+package pqtimeouts
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpUserTimeoutControl returns net.Dialer control function setting TCP_USER_TIMEOUT, the time
+// transmitted data may remain unacknowledged before the connection is closed.
+func tcpUserTimeoutControl(timeout time.Duration) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, int(timeout.Milliseconds()))
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,81 @@
+package pqtimeouts
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/monetha/mth-core/db/pqtimeouts/faultconn"
+	"golang.org/x/sys/unix"
+)
+
+func TestTCPUserTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	d, _, err := NewTimeoutDialer("host=localhost tcp_user_timeout=15s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c, err := d.DialTimeout("tcp", l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	checkTCPUserTimeout(t, c.(*net.TCPConn), 15000)
+
+	// connections wrapped to inject faults are dialed with the option too
+	WrapDialContext(faultconn.New().DialContext)(&connector{dialer: d})
+
+	fc, err := d.DialTimeout("tcp", l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer fc.Close()
+
+	checkTCPUserTimeout(t, fc.(*faultconn.Conn).Conn.(*net.TCPConn), 15000)
+}
+
+func TestTCPUserTimeoutZero(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	// zero timeout keeps the system default
+	d, _, err := NewTimeoutDialer("host=localhost tcp_user_timeout=0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c, err := d.DialTimeout("tcp", l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	checkTCPUserTimeout(t, c.(*net.TCPConn), 0)
+}
+
+func checkTCPUserTimeout(t *testing.T, c *net.TCPConn, expected int) {
+	t.Helper()
+
+	raw, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var timeout int
+	raw.Control(func(fd uintptr) {
+		timeout, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT)
+	})
+	if err != nil || timeout != expected {
+		t.Errorf("TCP_USER_TIMEOUT was not set: %d, %v", timeout, err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pqtimeouts
+
+import (
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeoutControl returns nil, TCP_USER_TIMEOUT is supported on Linux only.
+func tcpUserTimeoutControl(timeout time.Duration) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
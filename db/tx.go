@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultTxMaxAttempts = 3
+	defaultTxMinBackoff  = 10 * time.Millisecond
+	defaultTxMaxBackoff  = time.Second
+)
+
+// TxOptions are options of transactions run by InTx.
+type TxOptions struct {
+	// Isolation is the transaction isolation level. Default to the database default.
+	Isolation sql.IsolationLevel
+
+	// ReadOnly starts a read-only transaction.
+	ReadOnly bool
+
+	// MaxAttempts is the maximum number of attempts to run the transaction. Default to 3, 1 disables retries.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the jittered backoff between attempts. Default to 10ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// defaults for configuration
+func (o *TxOptions) defaults() {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = defaultTxMaxAttempts
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = defaultTxMinBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = defaultTxMaxBackoff
+	}
+}
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type txContextKey int
+
+const contextKeyTx txContextKey = iota
+
+// txContext is the transaction carried by a context.
+type txContext struct {
+	tx    *sql.Tx
+	depth int // savepoint nesting depth
+}
+
+// WithTx returns a new Context carrying the transaction. InTx called with the context runs the function
+// in a savepoint of the transaction instead of starting a new transaction.
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, contextKeyTx, &txContext{tx: tx})
+}
+
+// TxFromContext returns the transaction carried by the context, or nil.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	if tc, ok := ctx.Value(contextKeyTx).(*txContext); ok {
+		return tc.tx
+	}
+	return nil
+}
+
+// InTx runs f in a transaction, which is committed when f returns nil and rolled back when f returns
+// an error or panics. Transactions failed with a serialization failure (40001), a deadlock (40P01)
+// or a reset connection are retried with jittered backoff, so f must be safe to run again. Commits failed
+// with a reset connection are not retried, as the transaction may have been committed.
+//
+// When the context carries a transaction (see WithTx), f runs in a savepoint of it and opts are ignored,
+// retries are left to the outermost transaction:
+//
+//	err := db.InTx(ctx, sqlDB, nil, func(tx *sql.Tx) error {
+//		ctx := db.WithTx(ctx, tx)
+//		return createUser(ctx, sqlDB, user) // createUser calls db.InTx with ctx
+//	})
+func InTx(ctx context.Context, db *sql.DB, opts *TxOptions, f func(tx *sql.Tx) error) error {
+	if tc, ok := ctx.Value(contextKeyTx).(*txContext); ok {
+		return inSavepoint(ctx, tc, f)
+	}
+
+	var o TxOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.defaults()
+
+	b := &backoff.Backoff{
+		Min:    o.MinBackoff,
+		Max:    o.MaxBackoff,
+		Jitter: true,
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := runTx(ctx, db, &o, f)
+		if err == nil || !retry || attempt >= o.MaxAttempts {
+			return err
+		}
+
+		t := time.NewTimer(b.Duration())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// runTx runs a single attempt of the transaction and reports whether the failed attempt can be retried.
+func runTx(ctx context.Context, db *sql.DB, o *TxOptions, f func(tx *sql.Tx) error) (retry bool, err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly})
+	if err != nil {
+		return IsRetryable(err), err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return IsRetryable(err), err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return isTxConflict(err), err
+	}
+	return false, nil
+}
+
+// inSavepoint runs f in a savepoint of the transaction carried by the context.
+func inSavepoint(ctx context.Context, tc *txContext, f func(tx *sql.Tx) error) (err error) {
+	name := fmt.Sprintf("sp_%d", tc.depth+1)
+	if _, err := tc.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = tc.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	// nested calls with the savepoint context get deeper savepoints
+	tc.depth++
+	defer func() { tc.depth-- }()
+
+	err = f(tc.tx)
+
+	if err != nil {
+		if _, rerr := tc.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rerr != nil {
+			return fmt.Errorf("%w (rollback to savepoint: %v)", err, rerr)
+		}
+		return err
+	}
+
+	_, err = tc.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// IsRetryable reports whether the transaction failed with the error can be retried:
+// the error is a serialization failure, a deadlock or a connection error.
+func IsRetryable(err error) bool {
+	if isTxConflict(err) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// connection exception or the server is shutting down
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01"
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// isTxConflict reports whether the error is a serialization failure or a deadlock.
+func isTxConflict(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
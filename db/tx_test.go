@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/monetha/mth-core/db/internal/fakedb"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDB returns a database recording queries, the handler may fail them.
+func recordingDB(t *testing.T, fail func(query string) error) (*sql.DB, *[]string) {
+	var queries []string
+	db := fakedb.Open(func(ctx context.Context, query string, args []driver.NamedValue) fakedb.Result {
+		queries = append(queries, query)
+		if fail != nil {
+			return fakedb.Result{Err: fail(query)}
+		}
+		return fakedb.Result{}
+	})
+	t.Cleanup(func() { db.Close() })
+	return db, &queries
+}
+
+var fastRetries = &TxOptions{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestInTxCommitAndRollback(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	db, queries := recordingDB(t, nil)
+
+	r.NoError(InTx(ctx, db, nil, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE t SET a = 1")
+		return err
+	}))
+	r.Equal([]string{"BEGIN", "UPDATE t SET a = 1", "COMMIT"}, *queries)
+
+	*queries = nil
+	errFailed := errors.New("failed")
+	r.Equal(errFailed, InTx(ctx, db, nil, func(tx *sql.Tx) error { return errFailed }))
+	r.Equal([]string{"BEGIN", "ROLLBACK"}, *queries)
+
+	*queries = nil
+	r.Panics(func() {
+		_ = InTx(ctx, db, nil, func(tx *sql.Tx) error { panic("boom") })
+	})
+	r.Equal([]string{"BEGIN", "ROLLBACK"}, *queries)
+}
+
+func TestInTxRetries(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	attempts := 0
+	db, _ := recordingDB(t, func(query string) error {
+		if query == "COMMIT" && attempts < 3 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+
+	r.NoError(InTx(ctx, db, fastRetries, func(tx *sql.Tx) error {
+		attempts++
+		return nil
+	}))
+	r.Equal(3, attempts)
+
+	attempts = 0
+	err := InTx(ctx, db, &TxOptions{MaxAttempts: 1}, func(tx *sql.Tx) error {
+		attempts++
+		return fmt.Errorf("update: %w", &pq.Error{Code: "40P01"})
+	})
+	r.Error(err)
+	r.Equal(1, attempts)
+
+	attempts = 0
+	err = InTx(ctx, db, fastRetries, func(tx *sql.Tx) error {
+		attempts++
+		return &pq.Error{Code: "23505"}
+	})
+	r.Error(err)
+	r.Equal(1, attempts)
+}
+
+func TestInTxSavepoints(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	db, queries := recordingDB(t, nil)
+	errInner := errors.New("inner")
+
+	r.NoError(InTx(ctx, db, nil, func(tx *sql.Tx) error {
+		ctx := WithTx(ctx, tx)
+		r.Equal(tx, TxFromContext(ctx))
+
+		r.NoError(InTx(ctx, db, nil, func(tx *sql.Tx) error {
+			return InTx(ctx, db, nil, func(tx *sql.Tx) error { return nil })
+		}))
+		r.Equal(errInner, InTx(ctx, db, nil, func(tx *sql.Tx) error { return errInner }))
+		r.Panics(func() {
+			_ = InTx(ctx, db, nil, func(tx *sql.Tx) error { panic("boom") })
+		})
+		return InTx(ctx, db, nil, func(tx *sql.Tx) error { return nil })
+	}))
+
+	r.Equal([]string{
+		"BEGIN",
+		"SAVEPOINT sp_1",
+		"SAVEPOINT sp_2",
+		"RELEASE SAVEPOINT sp_2",
+		"RELEASE SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}, *queries)
+}
+
+func TestIsRetryable(t *testing.T) {
+	r := require.New(t)
+
+	r.True(IsRetryable(&pq.Error{Code: "40001"}))
+	r.True(IsRetryable(&pq.Error{Code: "40P01"}))
+	r.True(IsRetryable(&pq.Error{Code: "08006"}))
+	r.True(IsRetryable(driver.ErrBadConn))
+	r.False(IsRetryable(&pq.Error{Code: "23505"}))
+	r.False(IsRetryable(errors.New("failed")))
+}
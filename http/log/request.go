@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"net/http"
 
 	corelog "github.com/monetha/mth-core/log"
@@ -16,12 +17,24 @@ func RequestLogger(r *http.Request) *corelog.Logger {
 		corelog.RequestMethod(r.Method))
 }
 
-// ResponseLogger adds zap fields to log http response
+// ResponseLogger adds zap fields to log http response. Fields carried by the context of the request are
+// logged as well.
 func ResponseLogger(r *http.Response) *corelog.Logger {
+	ctx := context.Background()
+	if r != nil && r.Request != nil {
+		ctx = r.Request.Context()
+	}
+	return ContextResponseLogger(ctx, r)
+}
+
+// ContextResponseLogger adds zap fields to log http response, which may be nil when the request failed.
+// Fields carried by the context are logged as well.
+func ContextResponseLogger(ctx context.Context, r *http.Response) *corelog.Logger {
+	l := webcontext.NewLogger(ctx)
 	if r != nil {
-		return corelog.With(corelog.HTTPHeader(r.Header),
+		return l.With(corelog.HTTPHeader(r.Header),
 			corelog.StatusCode(r.StatusCode))
 	}
 
-	return corelog.With(zap.Any("http_response", nil))
+	return l.With(zap.Any("http_response", nil))
 }
@@ -270,7 +270,7 @@ func (e *Endpoint) do(req *http.Request, successV, failureV interface{}) (*http.
 	httplog.RequestLogger(req).Info("http request")
 
 	resp, err := e.Client.httpClient.Do(req)
-	l := httplog.ResponseLogger(resp)
+	l := httplog.ContextResponseLogger(req.Context(), resp)
 	if err != nil {
 		l.Error("http response")
 		return resp, err
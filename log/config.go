@@ -0,0 +1,414 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Encodings of log entries.
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+	EncodingLogfmt  = "logfmt"
+)
+
+// Sink types.
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+// LevelEncodingSyslog encodes levels as syslog severity codes, as NewProduction does.
+const LevelEncodingSyslog = "syslog"
+
+// Config is the logger configuration of New.
+type Config struct {
+	// Level is the minimal level of logged entries of the logger, SetLevel doesn't change it.
+	// Default to the level shared with other loggers built by the package, see SetLevel.
+	Level *zapcore.Level
+
+	// Encoding is the encoding of entries: json, console or logfmt. Default to json.
+	Encoding string
+
+	// LevelEncoding is the encoding of levels: syslog, lowercase, capital, color or capitalColor. Default to syslog.
+	LevelEncoding string
+
+	// Sampling limits entries with the same level and message logged per second, nil disables sampling.
+	Sampling *zap.SamplingConfig
+
+	// DisableCaller stops annotating entries with the caller.
+	DisableCaller bool
+
+	// CallerLevel is the minimal level of entries annotated with the caller. Default to DebugLevel.
+	CallerLevel *zapcore.Level
+
+	// StacktraceLevel is the minimal level of entries with the stacktrace. Default to ErrorLevel.
+	StacktraceLevel *zapcore.Level
+
+	// Service, Version and Env are logged with all entries as service, version and env fields when set.
+	Service string
+	Version string
+	Env     string
+
+	// Fields are logged with all entries.
+	Fields map[string]string
+
+	// Sinks are outputs of entries. Default to stdout.
+	Sinks []SinkConfig
+
+	// Redact is the redaction of sensitive data. Default to DefaultRedactConfig.
+	Redact *RedactConfig
+
+	// DisableRedact stops redacting sensitive data.
+	DisableRedact bool
+}
+
+// SinkConfig is an output of entries.
+type SinkConfig struct {
+	// Type is the sink type: stdout, stderr, file or syslog.
+	Type string
+
+	// Path is the path of the file sink.
+	Path string
+
+	// MaxSize is the size in bytes a file is rotated at. Default to 100 MiB.
+	MaxSize int64
+
+	// MaxBackups is the number of rotated files kept. Default to 5.
+	MaxBackups int
+
+	// Address is the host:port of the syslog server, messages are sent over UDP.
+	Address string
+
+	// Facility is the syslog facility code. Default to 16 (local0).
+	Facility int
+}
+
+// defaults for configuration
+func (c *Config) defaults() {
+	if c.Encoding == "" {
+		c.Encoding = EncodingJSON
+	}
+	if c.LevelEncoding == "" {
+		c.LevelEncoding = LevelEncodingSyslog
+	}
+	if c.CallerLevel == nil {
+		l := zapcore.DebugLevel
+		c.CallerLevel = &l
+	}
+	if c.StacktraceLevel == nil {
+		l := zapcore.ErrorLevel
+		c.StacktraceLevel = &l
+	}
+	if len(c.Sinks) == 0 {
+		c.Sinks = []SinkConfig{{Type: SinkStdout}}
+	}
+	if c.Redact == nil {
+		r := DefaultRedactConfig()
+		c.Redact = &r
+	}
+}
+
+// New creates a logger with the given config, and a function closing files and connections of its sinks.
+// Unless the level is configured, the level is shared with other loggers built by the package, see SetLevel.
+func New(config Config) (_ *zap.Logger, close func(), err error) {
+	config.defaults()
+
+	enc, err := config.encoder()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cores := make([]zapcore.Core, 0, len(config.Sinks))
+	var closers []io.Closer
+	close = func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}
+	for i, s := range config.Sinks {
+		core, closer, err := config.sinkCore(s, enc)
+		if err != nil {
+			close()
+			return nil, nil, fmt.Errorf("log: sink %d: %w", i, err)
+		}
+		cores = append(cores, core)
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+	}
+
+	var core zapcore.Core = zapcore.NewTee(cores...)
+	if *config.CallerLevel > zapcore.DebugLevel {
+		core = &callerCore{Core: core, level: *config.CallerLevel}
+	}
+	if s := config.Sampling; s != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, s.Initial, s.Thereafter)
+	}
+
+	opts := []zap.Option{
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+		zap.AddStacktrace(*config.StacktraceLevel),
+		zap.Fields(config.fields()...),
+	}
+	if !config.DisableCaller {
+		opts = append(opts, zap.AddCaller())
+	}
+	if !config.DisableRedact {
+		opts = append(opts, WrapRedactCore(*config.Redact))
+	}
+	ls := sharedLevels
+	if config.Level != nil {
+		ls = newLevels(*config.Level)
+	}
+	opts = append(opts, wrapLevelCore(ls))
+
+	return zap.New(core, opts...), close, nil
+}
+
+func (c *Config) encoder() (zapcore.Encoder, error) {
+	encCfg := ProductionEncoderConfig()
+	if c.LevelEncoding != LevelEncodingSyslog {
+		if err := encCfg.EncodeLevel.UnmarshalText([]byte(c.LevelEncoding)); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.Encoding {
+	case EncodingJSON:
+		return zapcore.NewJSONEncoder(encCfg), nil
+	case EncodingConsole:
+		return zapcore.NewConsoleEncoder(encCfg), nil
+	case EncodingLogfmt:
+		return newLogfmtEncoder(encCfg), nil
+	default:
+		return nil, fmt.Errorf("log: unknown encoding %q", c.Encoding)
+	}
+}
+
+// sinkCore returns the core of the sink, and the closer of the opened output, if any.
+func (c *Config) sinkCore(s SinkConfig, enc zapcore.Encoder) (zapcore.Core, io.Closer, error) {
+	// entries are filtered by shared levels
+	level := zapcore.DebugLevel
+
+	switch s.Type {
+	case SinkStdout:
+		return zapcore.NewCore(enc.Clone(), zapcore.Lock(os.Stdout), level), nil, nil
+	case SinkStderr:
+		return zapcore.NewCore(enc.Clone(), zapcore.Lock(os.Stderr), level), nil, nil
+	case SinkFile:
+		f, err := openRotatingFile(s.Path, s.MaxSize, s.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zapcore.NewCore(enc.Clone(), f, level), f, nil
+	case SinkSyslog:
+		facility := s.Facility
+		if facility == 0 {
+			facility = defaultSyslogFacility
+		}
+		core, err := newSyslogCore(enc.Clone(), s.Address, facility, c.Service)
+		if err != nil {
+			return nil, nil, err
+		}
+		return core, core.conn, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown sink type %q", s.Type)
+	}
+}
+
+func (c *Config) fields() []zapcore.Field {
+	var fields []zapcore.Field
+	for _, f := range []struct{ key, value string }{
+		{"service", c.Service},
+		{"version", c.Version},
+		{"env", c.Env},
+	} {
+		if f.value != "" {
+			fields = append(fields, zap.String(f.key, f.value))
+		}
+	}
+
+	keys := make([]string, 0, len(c.Fields))
+	for k := range c.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, zap.String(k, c.Fields[k]))
+	}
+	return fields
+}
+
+// ConfigFromEnv returns the config set by environment variables, unset variables are left to defaults:
+//
+//	LOG_LEVEL             level, e.g. debug
+//	LOG_ENCODING          json, console or logfmt
+//	LOG_LEVEL_ENCODING    syslog, lowercase, capital, color or capitalColor
+//	LOG_SAMPLING          initial/thereafter entries with the same level and message logged per second, e.g. 100/100
+//	LOG_DISABLE_CALLER    true to stop annotating entries with the caller
+//	LOG_CALLER_LEVEL      minimal level of entries annotated with the caller
+//	LOG_STACKTRACE_LEVEL  minimal level of entries with the stacktrace
+//	LOG_SERVICE           service field
+//	LOG_VERSION           version field
+//	LOG_ENV               env field
+//	LOG_FIELDS            comma-separated key=value fields
+//	LOG_SINKS             comma-separated sinks: stdout, stderr, file:///var/log/app.log?max_size=1048576&max_backups=3,
+//	                      syslog://localhost:514?facility=16
+//	LOG_DISABLE_REDACT    true to stop redacting sensitive data
+func ConfigFromEnv() (Config, error) {
+	var c Config
+	var err error
+
+	if c.Level, err = envLevel("LOG_LEVEL"); err != nil {
+		return c, err
+	}
+	c.Encoding = os.Getenv("LOG_ENCODING")
+	c.LevelEncoding = os.Getenv("LOG_LEVEL_ENCODING")
+	if v := os.Getenv("LOG_SAMPLING"); v != "" {
+		if c.Sampling, err = parseSampling(v); err != nil {
+			return c, fmt.Errorf("log: LOG_SAMPLING: %w", err)
+		}
+	}
+	if c.DisableCaller, err = envBool("LOG_DISABLE_CALLER"); err != nil {
+		return c, err
+	}
+	if c.CallerLevel, err = envLevel("LOG_CALLER_LEVEL"); err != nil {
+		return c, err
+	}
+	if c.StacktraceLevel, err = envLevel("LOG_STACKTRACE_LEVEL"); err != nil {
+		return c, err
+	}
+	c.Service = os.Getenv("LOG_SERVICE")
+	c.Version = os.Getenv("LOG_VERSION")
+	c.Env = os.Getenv("LOG_ENV")
+	if v := os.Getenv("LOG_FIELDS"); v != "" {
+		c.Fields = make(map[string]string)
+		for _, kv := range strings.Split(v, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return c, fmt.Errorf("log: LOG_FIELDS: invalid field %q", kv)
+			}
+			c.Fields[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if v := os.Getenv("LOG_SINKS"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			sink, err := ParseSink(strings.TrimSpace(s))
+			if err != nil {
+				return c, fmt.Errorf("log: LOG_SINKS: %w", err)
+			}
+			c.Sinks = append(c.Sinks, sink)
+		}
+	}
+	if c.DisableRedact, err = envBool("LOG_DISABLE_REDACT"); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// ParseSink parses the sink URL: stdout, stderr, file:///var/log/app.log?max_size=1048576&max_backups=3
+// or syslog://localhost:514?facility=16.
+func ParseSink(s string) (SinkConfig, error) {
+	switch s {
+	case SinkStdout, SinkStderr:
+		return SinkConfig{Type: s}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return SinkConfig{}, err
+	}
+	q := u.Query()
+
+	switch u.Scheme {
+	case SinkFile:
+		// file://app.log would be parsed as the path of the host
+		if u.Host != "" {
+			return SinkConfig{}, fmt.Errorf("sink %s: host must be empty, use file:///abs/app.log or file:app.log", s)
+		}
+		sink := SinkConfig{Type: SinkFile, Path: u.Path}
+		if u.Opaque != "" {
+			sink.Path = u.Opaque
+		}
+		if sink.Path == "" {
+			return SinkConfig{}, fmt.Errorf("sink %s: path must be set", s)
+		}
+		if v := q.Get("max_size"); v != "" {
+			if sink.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return SinkConfig{}, fmt.Errorf("sink %s: max_size: %w", s, err)
+			}
+		}
+		if v := q.Get("max_backups"); v != "" {
+			if sink.MaxBackups, err = strconv.Atoi(v); err != nil {
+				return SinkConfig{}, fmt.Errorf("sink %s: max_backups: %w", s, err)
+			}
+		}
+		return sink, nil
+	case SinkSyslog:
+		sink := SinkConfig{Type: SinkSyslog, Address: u.Host}
+		if sink.Address == "" {
+			return SinkConfig{}, fmt.Errorf("sink %s: address must be set", s)
+		}
+		if v := q.Get("facility"); v != "" {
+			if sink.Facility, err = strconv.Atoi(v); err != nil {
+				return SinkConfig{}, fmt.Errorf("sink %s: facility: %w", s, err)
+			}
+		}
+		return sink, nil
+	default:
+		return SinkConfig{}, fmt.Errorf("unknown sink %q", s)
+	}
+}
+
+func parseSampling(s string) (*zap.SamplingConfig, error) {
+	initial, thereafter, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid sampling %q, initial/thereafter expected", s)
+	}
+	var c zap.SamplingConfig
+	var err error
+	if c.Initial, err = strconv.Atoi(initial); err != nil {
+		return nil, err
+	}
+	if c.Thereafter, err = strconv.Atoi(thereafter); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func envBool(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("log: %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func envLevel(name string) (*zapcore.Level, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, nil
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(v)); err != nil {
+		return nil, fmt.Errorf("log: %s: %w", name, err)
+	}
+	return &l, nil
+}
@@ -0,0 +1,202 @@
+package log
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	r := require.New(t)
+
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_ENCODING", "logfmt")
+	t.Setenv("LOG_SAMPLING", "100/10")
+	t.Setenv("LOG_STACKTRACE_LEVEL", "fatal")
+	t.Setenv("LOG_SERVICE", "payments")
+	t.Setenv("LOG_FIELDS", "region=eu, zone=a")
+	t.Setenv("LOG_SINKS", "stdout, file:///var/log/app.log?max_size=1024&max_backups=2, syslog://localhost:514")
+	t.Setenv("LOG_DISABLE_REDACT", "true")
+
+	c, err := ConfigFromEnv()
+	r.NoError(err)
+
+	debug, fatal := zapcore.DebugLevel, zapcore.FatalLevel
+	r.Equal(Config{
+		Level:           &debug,
+		Encoding:        EncodingLogfmt,
+		Sampling:        &zap.SamplingConfig{Initial: 100, Thereafter: 10},
+		StacktraceLevel: &fatal,
+		Service:         "payments",
+		Fields:          map[string]string{"region": "eu", "zone": "a"},
+		Sinks: []SinkConfig{
+			{Type: SinkStdout},
+			{Type: SinkFile, Path: "/var/log/app.log", MaxSize: 1024, MaxBackups: 2},
+			{Type: SinkSyslog, Address: "localhost:514"},
+		},
+		DisableRedact: true,
+	}, c)
+
+	t.Setenv("LOG_SINKS", "kafka://localhost")
+	_, err = ConfigFromEnv()
+	r.Error(err)
+}
+
+func TestParseSink(t *testing.T) {
+	tests := []struct {
+		sink string
+		want SinkConfig
+		err  bool
+	}{
+		{"stderr", SinkConfig{Type: SinkStderr}, false},
+		{"file:app.log", SinkConfig{Type: SinkFile, Path: "app.log"}, false},
+		{"file:///var/log/app.log", SinkConfig{Type: SinkFile, Path: "/var/log/app.log"}, false},
+		{"file://relative/app.log", SinkConfig{}, true},
+		{"file:///var/log/app.log?max_size=big", SinkConfig{}, true},
+		{"syslog://10.0.0.1:514?facility=3", SinkConfig{Type: SinkSyslog, Address: "10.0.0.1:514", Facility: 3}, false},
+		{"syslog:///", SinkConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sink, func(t *testing.T) {
+			r := require.New(t)
+
+			sink, err := ParseSink(tt.sink)
+			if tt.err {
+				r.Error(err)
+				return
+			}
+			r.NoError(err)
+			r.Equal(tt.want, sink)
+		})
+	}
+}
+
+func TestNewFileSink(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	l, closeSinks, err := New(Config{
+		Encoding:      EncodingLogfmt,
+		DisableCaller: true,
+		Service:       "payments",
+		Sinks:         []SinkConfig{{Type: SinkFile, Path: path}},
+	})
+	r.NoError(err)
+	defer closeSinks()
+
+	l.Debug("filtered")
+	l.Info("card charged", zap.String("email", "john@example.com"), zap.Namespace("http"), zap.Int("status", 200))
+	r.NoError(l.Sync())
+
+	b, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Regexp(`^sts=\S+ level=6 msg="card charged" service=payments email=j\*\*\*\*\*@example.com http.status=200\n$`, string(b))
+
+	// writes fail once sinks are closed
+	closeSinks()
+	l.Info("after close")
+	r.Error(l.Sync())
+}
+
+func TestNewLevel(t *testing.T) {
+	r := require.New(t)
+	withSharedLevels(t)
+
+	_ = NewProduction()
+
+	// the configured level is the logger's own
+	debug := zapcore.DebugLevel
+	l, _, err := New(Config{Level: &debug, Sinks: []SinkConfig{{Type: SinkStderr}}})
+	r.NoError(err)
+	r.True(l.Core().Enabled(zapcore.DebugLevel))
+	r.Equal(zapcore.InfoLevel, GetLevel())
+
+	// otherwise the level is shared
+	l, _, err = New(Config{Sinks: []SinkConfig{{Type: SinkStderr}}})
+	r.NoError(err)
+	r.False(l.Core().Enabled(zapcore.DebugLevel))
+	SetLevel(zapcore.DebugLevel, 0)
+	r.True(l.Core().Enabled(zapcore.DebugLevel))
+}
+
+func TestNewSyslogSink(t *testing.T) {
+	r := require.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	r.NoError(err)
+	defer conn.Close()
+
+	l, closeSinks, err := New(Config{
+		Service: "payments",
+		Sinks:   []SinkConfig{{Type: SinkSyslog, Address: conn.LocalAddr().String()}},
+	})
+	r.NoError(err)
+	defer closeSinks()
+
+	l.Warn("slow request")
+
+	b := make([]byte, 2048)
+	r.NoError(conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(b)
+	r.NoError(err)
+
+	// local0 facility and warning severity
+	re := regexp.MustCompile(`^<132>1 \S+Z \S+ payments \d+ - - (\{.*\})$`)
+	m := re.FindStringSubmatch(string(b[:n]))
+	r.NotNil(m, string(b[:n]))
+	r.Contains(m[1], `"level":4`)
+	r.Contains(m[1], `"msg":"slow request"`)
+	r.Contains(m[1], `"service":"payments"`)
+}
+
+func TestRotatingFile(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := openRotatingFile(path, 10, 2)
+	r.NoError(err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		r.NoError(err)
+	}
+	r.NoError(f.Sync())
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		b, err := os.ReadFile(name)
+		r.NoError(err)
+		r.Equal(want, string(b))
+	}
+	_, err = os.Stat(path + ".3")
+	r.True(os.IsNotExist(err))
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	r := require.New(t)
+
+	enc := newLogfmtEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder})
+	child := enc.Clone()
+	child.AddString("user", "john doe")
+
+	buf, err := child.EncodeEntry(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hi"}, []zapcore.Field{
+		zap.Strings("tags", []string{"a", "b"}),
+		zap.String("empty", ""),
+		zap.Duration("took", time.Second),
+	})
+	r.NoError(err)
+	r.Equal(`level=info msg=hi user="john doe" tags="[\"a\",\"b\"]" empty="" took=1s`+"\n", buf.String())
+
+	// the parent encoder is not affected by fields of the child
+	buf, err = enc.EncodeEntry(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hi"}, nil)
+	r.NoError(err)
+	r.True(strings.HasPrefix(buf.String(), "level=info msg=hi\n"))
+}
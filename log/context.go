@@ -0,0 +1,59 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The key type is unexported to prevent collisions with context keys defined in
+// other packages.
+type fieldsContextKey int
+
+const contextKeyFields fieldsContextKey = iota
+
+// IntoContext returns a new Context carrying the fields, in addition to fields carried by ctx.
+// A field replaces the carried field with the same key. Loggers returned by FromContext log the fields,
+// so fields added as a request progresses (e.g. correlation ID, user ID) are logged by all of its handlers.
+func IntoContext(ctx context.Context, fields ...zapcore.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	carried := ContextFields(ctx)
+	merged := make([]zapcore.Field, 0, len(carried)+len(fields))
+	for _, f := range carried {
+		if !hasKey(fields, f.Key) {
+			merged = append(merged, f)
+		}
+	}
+	for i, f := range fields {
+		// the last of fields with the same key wins
+		if !hasKey(fields[i+1:], f.Key) {
+			merged = append(merged, f)
+		}
+	}
+
+	return context.WithValue(ctx, contextKeyFields, merged)
+}
+
+// ContextFields returns fields carried by the context.
+func ContextFields(ctx context.Context) []zapcore.Field {
+	fields, _ := ctx.Value(contextKeyFields).([]zapcore.Field)
+	return fields
+}
+
+// FromContext returns a logger logging fields carried by the context, see IntoContext.
+func FromContext(ctx context.Context) *Logger {
+	return (*Logger)(zap.L().With(ContextFields(ctx)...))
+}
+
+func hasKey(fields []zapcore.Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
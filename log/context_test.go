@@ -0,0 +1,42 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestIntoContext(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+	r.Empty(ContextFields(ctx))
+	r.Equal(ctx, IntoContext(ctx))
+
+	ctx = IntoContext(ctx, CorrelationID("cid"), UserID(1))
+	child := IntoContext(ctx, UserID(2), MerchantID(3), MerchantID(4))
+
+	r.Equal([]zapcore.Field{CorrelationID("cid"), UserID(1)}, ContextFields(ctx))
+	r.Equal([]zapcore.Field{CorrelationID("cid"), UserID(2), MerchantID(4)}, ContextFields(child))
+}
+
+func TestFromContext(t *testing.T) {
+	r := require.New(t)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	ctx := IntoContext(context.Background(), CorrelationID("cid"), UserID(1))
+	FromContext(ctx).Info("handled", StatusCode(200))
+
+	r.Equal(1, logs.Len())
+	r.Equal(map[string]interface{}{
+		"correlation_id": "cid",
+		"user_id":        int64(1),
+		"status_code":    int64(200),
+	}, logs.All()[0].ContextMap())
+}
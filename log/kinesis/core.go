@@ -0,0 +1,310 @@
+// Package kinesis ships log entries to an Amazon Kinesis stream with the batching producer of
+// data/kinesis/producer, so services can ship logs without a sidecar.
+//
+// Entries are queued and put to the producer in background, so logging never blocks on the stream.
+// When the queue fills up, debug entries are dropped first, then info entries, while warnings and errors
+// are written to the fallback (stderr). Entries the producer fails to put are written to the fallback too,
+// and so are DPanic, Panic and Fatal entries, as the program may crash before they are shipped:
+//
+//	p := producer.New(&producer.Config{StreamName: "logs", Client: client, Logger: zap.NewNop()})
+//	p.Start()
+//	core := kinesis.NewCore(&kinesis.Config{Producer: p, Service: "payments"})
+//	core.Start()
+//	logger := zap.New(zapcore.NewTee(stdoutCore, core))
+//	...
+//	core.Stop()
+//	p.Stop()
+//
+// The producer must be dedicated to the core, and it must not log to the core itself.
+package kinesis
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/monetha/mth-core/data/kinesis/producer"
+	"github.com/monetha/mth-core/log"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultQueueSize   = 1024
+	defaultSyncTimeout = time.Second
+)
+
+// Config is the Core configuration.
+type Config struct {
+	// Producer is the producer entries are put to.
+	Producer *producer.Producer
+
+	// Level is the level threshold of shipped entries. Default to InfoLevel.
+	Level zapcore.LevelEnabler
+
+	// Service and Instance make up the partition key of entries, "service/instance".
+	// Default to the executable name and the hostname.
+	Service  string
+	Instance string
+
+	// EncoderConfig is the config of the JSON encoder of entries. Default to log.ProductionEncoderConfig().
+	EncoderConfig *zapcore.EncoderConfig
+
+	// QueueSize is the number of entries queued to be put to the producer. Debug entries are dropped
+	// once the queue is half full. Default to 1024.
+	QueueSize int
+
+	// Fallback is where entries which can't be shipped are written to. Default to stderr.
+	Fallback zapcore.WriteSyncer
+
+	// SyncTimeout is the time Sync waits for queued entries to be put to the producer. Default to 1s.
+	SyncTimeout time.Duration
+}
+
+// defaults for configuration
+func (c *Config) defaults() {
+	if c.Level == nil {
+		c.Level = zapcore.InfoLevel
+	}
+	if c.Service == "" {
+		c.Service = filepath.Base(os.Args[0])
+	}
+	if c.Instance == "" {
+		c.Instance, _ = os.Hostname()
+	}
+	if c.EncoderConfig == nil {
+		encCfg := log.ProductionEncoderConfig()
+		c.EncoderConfig = &encCfg
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.Fallback == nil {
+		c.Fallback = os.Stderr
+	}
+	if c.SyncTimeout == 0 {
+		c.SyncTimeout = defaultSyncTimeout
+	}
+	if c.Producer == nil {
+		panic("kinesis: Producer must be set")
+	}
+}
+
+// entry is an encoded entry queued to be put to the producer, or a marker closing flushed
+// once the entries queued before it are put.
+type entry struct {
+	level   zapcore.Level
+	data    []byte
+	flushed chan struct{}
+}
+
+// shipper puts entries of a core and its children to the producer.
+type shipper struct {
+	config       *Config
+	partitionKey string
+	fallback     zapcore.WriteSyncer
+	queue        chan entry
+	failures     <-chan *producer.FailureRecord
+	dropped      atomic.Uint64
+
+	mu      sync.RWMutex // guards closing the queue
+	closed  bool
+	started atomic.Bool
+	stopped chan struct{}
+}
+
+// Core is a zapcore.Core shipping entries encoded as JSON to the Kinesis producer.
+type Core struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	s   *shipper
+}
+
+// NewCore creates a core with the given config. Entries are queued until Start is called.
+// Failures of the producer are listened to from now on, so failures before Start aren't lost.
+func NewCore(config *Config) *Core {
+	config.defaults()
+
+	partitionKey := config.Service
+	if config.Instance != "" {
+		partitionKey += "/" + config.Instance
+	}
+	if len(partitionKey) > 256 {
+		partitionKey = partitionKey[:256]
+	}
+
+	return &Core{
+		LevelEnabler: config.Level,
+		enc:          zapcore.NewJSONEncoder(*config.EncoderConfig),
+		s: &shipper{
+			config:       config,
+			partitionKey: partitionKey,
+			fallback:     zapcore.Lock(config.Fallback),
+			queue:        make(chan entry, config.QueueSize),
+			failures:     config.Producer.NotifyFailures(),
+			stopped:      make(chan struct{}),
+		},
+	}
+}
+
+// Start putting queued entries to the producer, and writing entries the producer fails to put to the fallback.
+// Calls after the first one are ignored.
+func (c *Core) Start() {
+	if !c.s.started.CompareAndSwap(false, true) {
+		return
+	}
+	go c.s.loop()
+	go c.s.handleFailures()
+}
+
+// Stop putting entries to the producer, queued entries are put before returning. Entries written
+// after Stop go to the fallback. Stop the producer after the core to flush the entries.
+func (c *Core) Stop() {
+	c.s.mu.Lock()
+	if c.s.closed {
+		c.s.mu.Unlock()
+		return
+	}
+	c.s.closed = true
+	close(c.s.queue)
+	c.s.mu.Unlock()
+
+	if c.s.started.Load() {
+		<-c.s.stopped
+	}
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (c *Core) Dropped() uint64 {
+	return c.s.dropped.Load()
+}
+
+// With implements zapcore.Core.
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := &Core{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), s: c.s}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+// Check implements zapcore.Core.
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	buf.Free()
+
+	if err := c.s.enqueue(entry{level: ent.Level, data: data}); err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// the program may crash before the entry is shipped, so write it to the fallback as well
+		_ = c.s.writeFallback(data)
+		_ = c.Sync()
+	}
+	return nil
+}
+
+// Sync implements zapcore.Core. Queued entries are put to the producer, waiting up to SyncTimeout,
+// and the fallback is synced. The producer ships put entries asynchronously.
+func (c *Core) Sync() error {
+	c.s.flush()
+	return c.s.fallback.Sync()
+}
+
+// enqueue queues the entry to be put to the producer. When the queue is full, warnings and errors are written
+// to the fallback and other entries are dropped, debug entries are dropped once the queue is half full.
+func (s *shipper) enqueue(e entry) error {
+	s.mu.RLock()
+	closed, queued := s.closed, false
+	if !closed && (e.level > zapcore.DebugLevel || len(s.queue) < cap(s.queue)/2) {
+		select {
+		case s.queue <- e:
+			queued = true
+		default:
+		}
+	}
+	s.mu.RUnlock()
+
+	switch {
+	case queued:
+		return nil
+	case closed:
+		return s.writeFallback(e.data)
+	}
+
+	if e.level >= zapcore.WarnLevel {
+		return s.writeFallback(e.data)
+	}
+	s.dropped.Add(1)
+	return nil
+}
+
+// flush waits until entries queued before the call are put to the producer, or SyncTimeout passes.
+func (s *shipper) flush() {
+	if !s.started.Load() {
+		return
+	}
+
+	timer := time.NewTimer(s.config.SyncTimeout)
+	defer timer.Stop()
+
+	flushed := make(chan struct{})
+	s.mu.RLock()
+	queued := false
+	if !s.closed {
+		select {
+		case s.queue <- entry{flushed: flushed}:
+			queued = true
+		case <-timer.C:
+		}
+	}
+	s.mu.RUnlock()
+	if !queued {
+		return
+	}
+
+	select {
+	case <-flushed:
+	case <-timer.C:
+	}
+}
+
+func (s *shipper) loop() {
+	defer close(s.stopped)
+
+	for e := range s.queue {
+		if e.flushed != nil {
+			close(e.flushed)
+			continue
+		}
+		if err := s.config.Producer.Put(e.data, s.partitionKey); err != nil {
+			_ = s.writeFallback(e.data)
+		}
+	}
+}
+
+// handleFailures writes entries the producer failed to put to the fallback, until the producer stops.
+func (s *shipper) handleFailures() {
+	for r := range s.failures {
+		_ = s.writeFallback(r.Data)
+	}
+}
+
+func (s *shipper) writeFallback(data []byte) error {
+	_, err := s.fallback.Write(data)
+	return err
+}
@@ -0,0 +1,199 @@
+package kinesis
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/monetha/mth-core/data/kinesis/producer"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// putterMock records put records, failing them when err is set.
+type putterMock struct {
+	mu      sync.Mutex
+	err     error
+	records []*k.PutRecordsRequestEntry
+}
+
+func (p *putterMock) PutRecords(input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.records = append(p.records, input.Records...)
+	return &k.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}, nil
+}
+
+// syncBuffer is a fallback safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.String()
+}
+
+func (b *syncBuffer) Sync() error { return nil }
+
+func newProducer(putter *putterMock) *producer.Producer {
+	// records bigger than the aggregation size are put as they are
+	return producer.New(&producer.Config{
+		StreamName:         "logs",
+		Client:             putter,
+		AggregateBatchSize: 1,
+		Logger:             zap.NewNop(),
+	})
+}
+
+func TestCoreShipsEntries(t *testing.T) {
+	r := require.New(t)
+
+	putter := &putterMock{}
+	p := newProducer(putter)
+	p.Start()
+
+	fallback := &syncBuffer{}
+	core := NewCore(&Config{Producer: p, Service: "payments", Instance: "pod-1", Fallback: fallback})
+	core.Start()
+
+	l := zap.New(core).With(zap.String("env", "test"))
+	l.Debug("below threshold")
+	l.Info("payment accepted", zap.Int64("deal_id", 1))
+
+	core.Stop()
+	p.Stop()
+
+	r.Len(putter.records, 1)
+	r.Equal("payments/pod-1", *putter.records[0].PartitionKey)
+	r.Contains(string(putter.records[0].Data), `"msg":"payment accepted","env":"test","deal_id":1`)
+	r.Empty(fallback.String())
+
+	// entries written after Stop go to the fallback
+	l.Info("after stop")
+	r.Contains(fallback.String(), `"msg":"after stop"`)
+}
+
+func TestCoreBackpressure(t *testing.T) {
+	r := require.New(t)
+
+	fallback := &syncBuffer{}
+	core := NewCore(&Config{
+		Producer:  newProducer(&putterMock{}),
+		Level:     zapcore.DebugLevel,
+		QueueSize: 4,
+		Fallback:  fallback,
+	})
+	// not started, so entries stay queued
+	l := zap.New(core)
+
+	l.Debug("debug 1")
+	l.Debug("debug 2")
+	l.Debug("debug 3") // dropped, the queue is half full
+	l.Info("info 1")
+	l.Info("info 2")
+	l.Info("info 3") // dropped, the queue is full
+	l.Error("error 1")
+
+	r.EqualValues(2, core.Dropped())
+	r.Len(core.s.queue, 4)
+	r.Contains(fallback.String(), `"msg":"error 1"`)
+	r.NotContains(fallback.String(), `"msg":"info 3"`)
+}
+
+func TestCoreFallbackOnFailure(t *testing.T) {
+	r := require.New(t)
+
+	putter := &putterMock{err: errors.New("stream not found")}
+	p := newProducer(putter)
+	p.Start()
+
+	fallback := &syncBuffer{}
+	core := NewCore(&Config{Producer: p, Fallback: fallback})
+	core.Start()
+
+	zap.New(core).Warn("lost connection")
+
+	core.Stop()
+	p.Stop()
+
+	// failures are handled asynchronously
+	r.Eventually(func() bool {
+		return strings.Contains(fallback.String(), `"msg":"lost connection"`)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCoreFailuresBeforeStart(t *testing.T) {
+	r := require.New(t)
+
+	putter := &putterMock{err: errors.New("stream not found")}
+	p := newProducer(putter)
+	p.Start()
+
+	fallback := &syncBuffer{}
+	core := NewCore(&Config{Producer: p, Fallback: fallback})
+
+	// the producer fails to put the record before the core is started
+	r.NoError(p.Put([]byte(`{"msg":"put before start"}`), "logs"))
+	p.Stop()
+
+	core.Start()
+	core.Start()
+	core.Stop()
+
+	r.Eventually(func() bool {
+		return strings.Contains(fallback.String(), `"msg":"put before start"`)
+	}, time.Second, 10*time.Millisecond)
+}
+
+// fatalHook records fatal entries instead of exiting.
+type fatalHook struct {
+	called bool
+}
+
+func (h *fatalHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	h.called = true
+}
+
+func TestCoreFatal(t *testing.T) {
+	r := require.New(t)
+
+	putter := &putterMock{}
+	p := newProducer(putter)
+	p.Start()
+
+	fallback := &syncBuffer{}
+	core := NewCore(&Config{Producer: p, Fallback: fallback})
+	core.Start()
+
+	hook := &fatalHook{}
+	zap.New(core, zap.WithFatalHook(hook)).Fatal("out of memory")
+	r.True(hook.called)
+
+	// the entry is put to the producer and written to the fallback before the exit
+	r.Empty(core.s.queue)
+	r.Contains(fallback.String(), `"msg":"out of memory"`)
+
+	core.Stop()
+	p.Stop()
+
+	r.Len(putter.records, 1)
+	r.Contains(string(putter.records[0].Data), `"msg":"out of memory"`)
+}
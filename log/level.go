@@ -0,0 +1,319 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// noOverride is the minimal override level when there are no overrides, it enables no level.
+const noOverride = zapcore.FatalLevel + 1
+
+// sharedLevels are levels of loggers built with NewProduction and NewDevelopment.
+var sharedLevels = newLevels(zapcore.InfoLevel)
+
+// AtomicLevel returns the level shared by loggers built with NewProduction and NewDevelopment.
+// Changes of the level apply to all of them immediately.
+func AtomicLevel() zap.AtomicLevel {
+	return sharedLevels.base
+}
+
+// GetLevel returns the level of loggers built with NewProduction and NewDevelopment.
+func GetLevel() zapcore.Level {
+	return sharedLevels.base.Level()
+}
+
+// SetLevel sets the level of loggers built with NewProduction and NewDevelopment. When ttl is positive,
+// the level is reverted after ttl to the level it had before the first of pending timed changes.
+func SetLevel(l zapcore.Level, ttl time.Duration) {
+	sharedLevels.set("", l, ttl)
+}
+
+// SetNamedLevel overrides the level of the named logger and its children (e.g. "db" overrides "db.cluster")
+// of loggers built with NewProduction and NewDevelopment. When ttl is positive, the override is reverted after ttl.
+func SetNamedLevel(name string, l zapcore.Level, ttl time.Duration) {
+	sharedLevels.set(name, l, ttl)
+}
+
+// ResetNamedLevel removes the level override of the named logger.
+func ResetNamedLevel(name string) {
+	sharedLevels.remove(name)
+}
+
+// NamedLevels returns level overrides by logger names.
+func NamedLevels() map[string]zapcore.Level {
+	return sharedLevels.overrides()
+}
+
+// levelRevert is a pending revert of a timed level change.
+type levelRevert struct {
+	timer   *time.Timer
+	prev    zapcore.Level
+	hadPrev bool
+}
+
+// levels are the base level and level overrides by logger names.
+type levels struct {
+	base zap.AtomicLevel
+
+	mu      sync.Mutex
+	named   atomic.Pointer[map[string]zapcore.Level] // copied on write
+	min     atomic.Int32                             // minimal override level
+	reverts map[string]*levelRevert                  // by logger name, "" is the base level
+	baseSet bool                                     // the base level was set at runtime
+}
+
+func newLevels(l zapcore.Level) *levels {
+	ls := &levels{
+		base:    zap.NewAtomicLevelAt(l),
+		reverts: make(map[string]*levelRevert),
+	}
+	ls.named.Store(&map[string]zapcore.Level{})
+	ls.min.Store(int32(noOverride))
+	return ls
+}
+
+// enabled reports whether the level is enabled for any logger name.
+func (ls *levels) enabled(l zapcore.Level) bool {
+	return ls.base.Enabled(l) || l >= zapcore.Level(ls.min.Load())
+}
+
+// level returns the level of the named logger: the override of the longest matching name, or the base level.
+func (ls *levels) level(name string) zapcore.Level {
+	named := *ls.named.Load()
+	if len(named) > 0 {
+		for n := name; n != ""; {
+			if l, ok := named[n]; ok {
+				return l
+			}
+			i := strings.LastIndexByte(n, '.')
+			if i < 0 {
+				break
+			}
+			n = n[:i]
+		}
+	}
+	return ls.base.Level()
+}
+
+func (ls *levels) overrides() map[string]zapcore.Level {
+	named := *ls.named.Load()
+	m := make(map[string]zapcore.Level, len(named))
+	for n, l := range named {
+		m[n] = l
+	}
+	return m
+}
+
+func (ls *levels) set(name string, l zapcore.Level, ttl time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if name == "" {
+		ls.baseSet = true
+	}
+
+	prev, hadPrev := ls.get(name)
+	if r, ok := ls.reverts[name]; ok {
+		r.timer.Stop()
+		delete(ls.reverts, name)
+		prev, hadPrev = r.prev, r.hadPrev
+	}
+
+	ls.store(name, l, true)
+
+	if ttl > 0 {
+		r := &levelRevert{prev: prev, hadPrev: hadPrev}
+		r.timer = time.AfterFunc(ttl, func() { ls.revert(name, r) })
+		ls.reverts[name] = r
+	}
+}
+
+// setDefault sets the base level of a logger being built, unless the base level was set at runtime.
+func (ls *levels) setDefault(l zapcore.Level) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if !ls.baseSet {
+		ls.store("", l, true)
+	}
+}
+
+func (ls *levels) remove(name string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if r, ok := ls.reverts[name]; ok {
+		r.timer.Stop()
+		delete(ls.reverts, name)
+	}
+	ls.store(name, 0, false)
+}
+
+func (ls *levels) revert(name string, r *levelRevert) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	// the revert was canceled by a later change
+	if ls.reverts[name] != r {
+		return
+	}
+	delete(ls.reverts, name)
+	ls.store(name, r.prev, r.hadPrev)
+}
+
+// get returns the level of the exact name, the caller must hold ls.mu.
+func (ls *levels) get(name string) (zapcore.Level, bool) {
+	if name == "" {
+		return ls.base.Level(), true
+	}
+	l, ok := (*ls.named.Load())[name]
+	return l, ok
+}
+
+// store sets or removes the level of the exact name, the caller must hold ls.mu.
+func (ls *levels) store(name string, l zapcore.Level, ok bool) {
+	if name == "" {
+		ls.base.SetLevel(l)
+		return
+	}
+
+	named := ls.overrides()
+	if ok {
+		named[name] = l
+	} else {
+		delete(named, name)
+	}
+
+	min := noOverride
+	for _, l := range named {
+		if l < min {
+			min = l
+		}
+	}
+	ls.named.Store(&named)
+	ls.min.Store(int32(min))
+}
+
+// levelCore filters entries by levels of logger names.
+type levelCore struct {
+	zapcore.Core
+	levels *levels
+}
+
+// wrapLevelCore wraps the core of a logger built with a permissive level, so levels filter entries instead.
+func wrapLevelCore(ls *levels) zap.Option {
+	return zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &levelCore{Core: c, levels: ls}
+	})
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.levels.enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.level(ent.LoggerName).Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// levelRequest is the body of PUT requests of the level handler.
+type levelRequest struct {
+	Level *zapcore.Level `json:"level"`
+	Name  string         `json:"name,omitempty"`
+	TTL   string         `json:"ttl,omitempty"`
+}
+
+// levelResponse is the body of responses of the level handler.
+type levelResponse struct {
+	Level     zapcore.Level            `json:"level"`
+	Overrides map[string]zapcore.Level `json:"overrides"`
+}
+
+type levelError struct {
+	Error string `json:"error"`
+}
+
+// LevelHandler returns a handler of levels of loggers built with NewProduction and NewDevelopment,
+// to be mounted on the admin handler, e.g. admin.Handle("/log/level", log.LevelHandler()).
+//
+// GET responds with the level and level overrides by logger names:
+//
+//	{"level":"info","overrides":{"db":"debug"}}
+//
+// PUT sets the level, or the override of the named logger when name is set. The change is reverted after
+// ttl when it's set. Null level removes the override of the named logger:
+//
+//	{"level":"debug","name":"db","ttl":"10m"}
+func LevelHandler() http.Handler {
+	return levelHandler{sharedLevels}
+}
+
+type levelHandler struct {
+	levels *levels
+}
+
+func (h levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := h.put(r); err != nil {
+			writeLevelJSON(w, http.StatusBadRequest, levelError{Error: err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeLevelJSON(w, http.StatusMethodNotAllowed, levelError{Error: "only GET and PUT are supported"})
+		return
+	}
+
+	writeLevelJSON(w, http.StatusOK, levelResponse{
+		Level:     h.levels.base.Level(),
+		Overrides: h.levels.overrides(),
+	})
+}
+
+func (h levelHandler) put(r *http.Request) error {
+	var req levelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			return fmt.Errorf("invalid ttl: %w", err)
+		}
+	}
+
+	switch {
+	case req.Level != nil:
+		h.levels.set(req.Name, *req.Level, ttl)
+	case req.Name != "":
+		h.levels.remove(req.Name)
+	default:
+		return errors.New("level must be set")
+	}
+	return nil
+}
+
+func writeLevelJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,163 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newObservedLogger(ls *levels) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(core, wrapLevelCore(ls)), logs
+}
+
+func TestLevelsNamedOverrides(t *testing.T) {
+	r := require.New(t)
+
+	ls := newLevels(zapcore.InfoLevel)
+	l, logs := newObservedLogger(ls)
+
+	ls.set("db", zapcore.DebugLevel, 0)
+	ls.set("db.cluster", zapcore.ErrorLevel, 0)
+
+	l.Debug("root")
+	l.Named("db").Debug("db")
+	l.Named("db").Named("lock").Debug("db.lock")
+	l.Named("db").Named("cluster").Warn("db.cluster")
+	l.Named("dbx").Debug("dbx")
+	l.Named("http").Info("http")
+
+	var messages []string
+	for _, e := range logs.All() {
+		messages = append(messages, e.Message)
+	}
+	r.Equal([]string{"db", "db.lock", "http"}, messages)
+
+	ls.remove("db")
+	r.False(l.Core().Enabled(zapcore.DebugLevel))
+	r.Equal(map[string]zapcore.Level{"db.cluster": zapcore.ErrorLevel}, ls.overrides())
+}
+
+func TestLevelsRevert(t *testing.T) {
+	r := require.New(t)
+
+	ls := newLevels(zapcore.InfoLevel)
+
+	ls.set("", zapcore.DebugLevel, 50*time.Millisecond)
+	// extending the timed change keeps the level to revert to
+	ls.set("", zapcore.WarnLevel, 100*time.Millisecond)
+	ls.set("db", zapcore.DebugLevel, 50*time.Millisecond)
+
+	r.Equal(zapcore.WarnLevel, ls.base.Level())
+	r.Equal(zapcore.DebugLevel, ls.level("db"))
+
+	r.Eventually(func() bool {
+		return ls.base.Level() == zapcore.InfoLevel && len(ls.overrides()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// permanent change cancels the pending revert
+	ls.set("", zapcore.DebugLevel, 20*time.Millisecond)
+	ls.set("", zapcore.ErrorLevel, 0)
+	time.Sleep(50 * time.Millisecond)
+	r.Equal(zapcore.ErrorLevel, ls.base.Level())
+}
+
+func TestLevelsSetDefault(t *testing.T) {
+	r := require.New(t)
+
+	ls := newLevels(zapcore.InfoLevel)
+
+	// loggers built later set their level
+	ls.setDefault(zapcore.WarnLevel)
+	ls.setDefault(zapcore.DebugLevel)
+	r.Equal(zapcore.DebugLevel, ls.base.Level())
+
+	// until the level is set at runtime, the pending revert is kept
+	ls.set("", zapcore.ErrorLevel, 50*time.Millisecond)
+	ls.setDefault(zapcore.InfoLevel)
+	r.Equal(zapcore.ErrorLevel, ls.base.Level())
+	r.Eventually(func() bool {
+		return ls.base.Level() == zapcore.DebugLevel
+	}, time.Second, 10*time.Millisecond)
+
+	ls.setDefault(zapcore.InfoLevel)
+	r.Equal(zapcore.DebugLevel, ls.base.Level())
+}
+
+// withSharedLevels replaces shared levels for the test.
+func withSharedLevels(t *testing.T) {
+	prev := sharedLevels
+	sharedLevels = newLevels(zapcore.InfoLevel)
+	t.Cleanup(func() { sharedLevels = prev })
+}
+
+func TestConstructorsLevel(t *testing.T) {
+	r := require.New(t)
+	withSharedLevels(t)
+
+	_ = NewProduction()
+	r.Equal(zapcore.InfoLevel, GetLevel())
+	_ = NewDevelopment()
+	r.Equal(zapcore.DebugLevel, GetLevel())
+}
+
+func TestConstructorsKeepLevel(t *testing.T) {
+	r := require.New(t)
+	withSharedLevels(t)
+
+	// the level set before building loggers is kept
+	SetLevel(zapcore.WarnLevel, 0)
+	_ = NewProduction()
+	r.Equal(zapcore.WarnLevel, GetLevel())
+
+	// building loggers keeps the level set at runtime and its pending revert
+	SetLevel(zapcore.ErrorLevel, 50*time.Millisecond)
+	_ = NewDevelopment()
+	_ = NewProduction()
+	r.Equal(zapcore.ErrorLevel, GetLevel())
+	r.Eventually(func() bool {
+		return GetLevel() == zapcore.WarnLevel
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLevelHandler(t *testing.T) {
+	h := levelHandler{newLevels(zapcore.InfoLevel)}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		resp   string
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, `{"level":"info","overrides":{}}`},
+		{"set level", http.MethodPut, `{"level":"debug"}`, http.StatusOK, `{"level":"debug","overrides":{}}`},
+		{"set named level", http.MethodPut, `{"level":"warn","name":"db","ttl":"1m"}`, http.StatusOK, `{"level":"debug","overrides":{"db":"warn"}}`},
+		{"remove named level", http.MethodPut, `{"name":"db"}`, http.StatusOK, `{"level":"debug","overrides":{}}`},
+		{"invalid level", http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest, ""},
+		{"invalid ttl", http.MethodPut, `{"level":"info","ttl":"soon"}`, http.StatusBadRequest, ""},
+		{"no level", http.MethodPut, `{}`, http.StatusBadRequest, `{"error":"level must be set"}`},
+		{"method not allowed", http.MethodPost, `{"level":"info"}`, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/log/level", strings.NewReader(tt.body)))
+
+			r.Equal(tt.status, rec.Code)
+			if tt.resp != "" {
+				r.JSONEq(tt.resp, rec.Body.String())
+			}
+		})
+	}
+}
@@ -29,32 +29,48 @@ func init() {
 	ReplaceGlobals(zap.L())
 }
 
-// NewDevelopment creates logger for development
+// NewDevelopment creates logger for development. The level is shared with other loggers built by the package,
+// it's set to DebugLevel unless it was changed with SetLevel, see SetLevel.
 func NewDevelopment() *zap.Logger {
 	config := zap.NewDevelopmentConfig()
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	// turn off logging stack traces at warn level
 	config.Development = false
-	l, err := config.Build()
+	// entries are filtered by shared levels
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	sharedLevels.setDefault(zapcore.DebugLevel)
+	l, err := config.Build(wrapLevelCore(sharedLevels))
 	if err != nil {
 		panic(fmt.Sprintf("failed to build development logger: %v", err))
 	}
 	return l
 }
 
-// NewProduction creates logger for production
+// NewProduction creates logger for production. The level is shared with other loggers built by the package,
+// it's set to InfoLevel unless it was changed with SetLevel, see SetLevel. Sensitive data is redacted as configured by DefaultRedactConfig.
 func NewProduction() *zap.Logger {
 	config := zap.NewProductionConfig()
-	config.EncoderConfig.TimeKey = "sts"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.EncodeLevel = syslogLevelEncoder
-	l, err := config.Build()
+	config.EncoderConfig = ProductionEncoderConfig()
+	// entries are filtered by shared levels
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	sharedLevels.setDefault(zapcore.InfoLevel)
+	l, err := config.Build(WrapRedactCore(DefaultRedactConfig()), wrapLevelCore(sharedLevels))
 	if err != nil {
 		panic(fmt.Sprintf("failed to build production logger: %v", err))
 	}
 	return l
 }
 
+// ProductionEncoderConfig returns the encoder config of NewProduction: ISO8601 time in the "sts" key,
+// and the level encoded as the syslog severity code.
+func ProductionEncoderConfig() zapcore.EncoderConfig {
+	config := zap.NewProductionEncoderConfig()
+	config.TimeKey = "sts"
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.EncodeLevel = syslogLevelEncoder
+	return config
+}
+
 // Logger extends zap.Logger
 type Logger zap.Logger
 
@@ -266,7 +282,7 @@ func syslogCode(l zapcore.Level) int {
 	}
 }
 
-// ReplaceGlobals replaces the global loggers
+// ReplaceGlobals replaces the global loggers. The slog default logger is replaced only after RedirectSlog.
 func ReplaceGlobals(l *zap.Logger) {
 	zap.ReplaceGlobals(l)
 	zap.RedirectStdLog(l)
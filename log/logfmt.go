@@ -0,0 +1,238 @@
+package log
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+var logfmtPool = buffer.NewPool()
+
+// logfmtEncoder encodes entries as logfmt lines of key=value pairs. Objects and arrays are encoded
+// as JSON values, keys of namespaces are prefixed with the namespace, e.g. "http.status_code=200".
+type logfmtEncoder struct {
+	cfg    *zapcore.EncoderConfig
+	fields *buffer.Buffer // encoded fields added with With, each preceded by a space
+	ns     string
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{cfg: &cfg, fields: logfmtPool.Get()}
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	c := &logfmtEncoder{cfg: e.cfg, fields: logfmtPool.Get(), ns: e.ns}
+	_, _ = c.fields.Write(e.fields.Bytes())
+	return c
+}
+
+func (e *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	line := logfmtPool.Get()
+
+	c := &logfmtEncoder{cfg: e.cfg, fields: line}
+	if e.cfg.TimeKey != "" && !ent.Time.IsZero() {
+		c.addPrimitive(e.cfg.TimeKey, func(enc zapcore.PrimitiveArrayEncoder) { e.timeEncoder()(ent.Time, enc) })
+	}
+	if e.cfg.LevelKey != "" && e.cfg.EncodeLevel != nil {
+		c.addPrimitive(e.cfg.LevelKey, func(enc zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeLevel(ent.Level, enc) })
+	}
+	if e.cfg.NameKey != "" && ent.LoggerName != "" {
+		c.AddString(e.cfg.NameKey, ent.LoggerName)
+	}
+	if e.cfg.CallerKey != "" && ent.Caller.Defined {
+		c.AddString(e.cfg.CallerKey, ent.Caller.TrimmedPath())
+	}
+	if e.cfg.MessageKey != "" {
+		c.AddString(e.cfg.MessageKey, ent.Message)
+	}
+
+	_, _ = line.Write(e.fields.Bytes())
+	c.ns = e.ns
+	for _, f := range fields {
+		f.AddTo(c)
+	}
+
+	if e.cfg.StacktraceKey != "" && ent.Stack != "" {
+		c.ns = ""
+		c.AddString(e.cfg.StacktraceKey, ent.Stack)
+	}
+
+	// drop the space preceding the first pair
+	b := strings.TrimPrefix(line.String(), " ")
+	line.Reset()
+	line.AppendString(b)
+	line.AppendString(e.lineEnding())
+	return line, nil
+}
+
+func (e *logfmtEncoder) timeEncoder() zapcore.TimeEncoder {
+	if e.cfg.EncodeTime != nil {
+		return e.cfg.EncodeTime
+	}
+	return zapcore.RFC3339NanoTimeEncoder
+}
+
+func (e *logfmtEncoder) lineEnding() string {
+	if e.cfg.LineEnding != "" {
+		return e.cfg.LineEnding
+	}
+	return zapcore.DefaultLineEnding
+}
+
+// addPrimitive adds the value encoded by f with an encoder function of the config, e.g. EncodeTime.
+func (e *logfmtEncoder) addPrimitive(key string, f func(enc zapcore.PrimitiveArrayEncoder)) {
+	enc := zapcore.NewMapObjectEncoder()
+	_ = enc.AddArray(key, zapcore.ArrayMarshalerFunc(func(ae zapcore.ArrayEncoder) error {
+		f(ae)
+		return nil
+	}))
+	if vs, _ := enc.Fields[key].([]interface{}); len(vs) > 0 {
+		e.addValue(key, vs[0])
+	}
+}
+
+func (e *logfmtEncoder) addValue(key string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		e.AddString(key, v)
+	case time.Time:
+		e.AddTime(key, v)
+	case time.Duration:
+		e.AddDuration(key, v)
+	case fmt.Stringer:
+		e.AddString(key, v.String())
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		e.appendPair(key, fmt.Sprint(v))
+	default:
+		_ = e.AddReflected(key, v)
+	}
+}
+
+func (e *logfmtEncoder) appendPair(key, value string) {
+	e.fields.AppendByte(' ')
+	if e.ns != "" {
+		e.fields.AppendString(e.ns)
+		e.fields.AppendByte('.')
+	}
+	e.fields.AppendString(key)
+	e.fields.AppendByte('=')
+	e.fields.AppendString(value)
+}
+
+func (e *logfmtEncoder) appendQuoted(key, value string) {
+	if needsQuoting(value) {
+		value = strconv.Quote(value)
+	}
+	e.appendPair(key, value)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *logfmtEncoder) appendJSON(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.appendQuoted(key, string(b))
+	return nil
+}
+
+func (e *logfmtEncoder) AddArray(key string, v zapcore.ArrayMarshaler) error {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := enc.AddArray(key, v); err != nil {
+		return err
+	}
+	return e.appendJSON(key, enc.Fields[key])
+}
+
+func (e *logfmtEncoder) AddObject(key string, v zapcore.ObjectMarshaler) error {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := enc.AddObject(key, v); err != nil {
+		return err
+	}
+	return e.appendJSON(key, enc.Fields[key])
+}
+
+func (e *logfmtEncoder) AddBinary(key string, v []byte) {
+	e.appendPair(key, base64.StdEncoding.EncodeToString(v))
+}
+
+func (e *logfmtEncoder) AddByteString(key string, v []byte) { e.AddString(key, string(v)) }
+func (e *logfmtEncoder) AddBool(key string, v bool)         { e.appendPair(key, strconv.FormatBool(v)) }
+
+func (e *logfmtEncoder) AddComplex128(key string, v complex128) {
+	e.appendPair(key, strconv.FormatComplex(v, 'g', -1, 128))
+}
+
+func (e *logfmtEncoder) AddComplex64(key string, v complex64) {
+	e.appendPair(key, strconv.FormatComplex(complex128(v), 'g', -1, 64))
+}
+
+func (e *logfmtEncoder) AddDuration(key string, v time.Duration) {
+	if e.cfg.EncodeDuration == nil {
+		e.appendPair(key, v.String())
+		return
+	}
+	e.addPrimitive(key, func(enc zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeDuration(v, enc) })
+}
+
+func (e *logfmtEncoder) AddFloat64(key string, v float64) {
+	switch {
+	case math.IsNaN(v):
+		e.appendPair(key, "NaN")
+	case math.IsInf(v, 1):
+		e.appendPair(key, "+Inf")
+	case math.IsInf(v, -1):
+		e.appendPair(key, "-Inf")
+	default:
+		e.appendPair(key, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+}
+
+func (e *logfmtEncoder) AddFloat32(key string, v float32) { e.AddFloat64(key, float64(v)) }
+func (e *logfmtEncoder) AddInt(key string, v int)         { e.AddInt64(key, int64(v)) }
+func (e *logfmtEncoder) AddInt64(key string, v int64)     { e.appendPair(key, strconv.FormatInt(v, 10)) }
+func (e *logfmtEncoder) AddInt32(key string, v int32)     { e.AddInt64(key, int64(v)) }
+func (e *logfmtEncoder) AddInt16(key string, v int16)     { e.AddInt64(key, int64(v)) }
+func (e *logfmtEncoder) AddInt8(key string, v int8)       { e.AddInt64(key, int64(v)) }
+func (e *logfmtEncoder) AddString(key, v string)          { e.appendQuoted(key, v) }
+
+func (e *logfmtEncoder) AddTime(key string, v time.Time) {
+	e.addPrimitive(key, func(enc zapcore.PrimitiveArrayEncoder) { e.timeEncoder()(v, enc) })
+}
+
+func (e *logfmtEncoder) AddUint(key string, v uint)       { e.AddUint64(key, uint64(v)) }
+func (e *logfmtEncoder) AddUint64(key string, v uint64)   { e.appendPair(key, strconv.FormatUint(v, 10)) }
+func (e *logfmtEncoder) AddUint32(key string, v uint32)   { e.AddUint64(key, uint64(v)) }
+func (e *logfmtEncoder) AddUint16(key string, v uint16)   { e.AddUint64(key, uint64(v)) }
+func (e *logfmtEncoder) AddUint8(key string, v uint8)     { e.AddUint64(key, uint64(v)) }
+func (e *logfmtEncoder) AddUintptr(key string, v uintptr) { e.AddUint64(key, uint64(v)) }
+
+func (e *logfmtEncoder) AddReflected(key string, v interface{}) error {
+	return e.appendJSON(key, v)
+}
+
+func (e *logfmtEncoder) OpenNamespace(key string) {
+	if e.ns != "" {
+		key = e.ns + "." + key
+	}
+	e.ns = key
+}
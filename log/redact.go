@@ -0,0 +1,406 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	mask = "*****"
+
+	// partialMaskMinLength is the minimal length of values partially masked, shorter values are masked fully.
+	partialMaskMinLength = 9
+	partialMaskKeep      = 4
+)
+
+// MaskMode is the way a sensitive value is masked.
+type MaskMode int
+
+const (
+	// MaskFull replaces the value with "*****".
+	MaskFull MaskMode = iota
+	// MaskPartial keeps the last 4 characters of the value, e.g. "*****4242". Values shorter than
+	// 9 characters are masked fully.
+	MaskPartial
+	// MaskEmail keeps the first character and the domain of the email, e.g. "j*****@example.com".
+	MaskEmail
+	// MaskURL keeps the scheme and the host of the URL, e.g. "https://example.com/*****".
+	MaskURL
+)
+
+// RedactPattern is a pattern of sensitive values in strings.
+type RedactPattern struct {
+	// Regexp matches the sensitive values.
+	Regexp *regexp.Regexp
+
+	// Mode is the way the matched values are masked.
+	Mode MaskMode
+
+	// Valid reports whether the matched value is sensitive, e.g. a card number passes the Luhn check.
+	// All matched values are sensitive when Valid is nil.
+	Valid func(s string) bool
+}
+
+// RedactConfig configures redaction of sensitive data of log entries.
+type RedactConfig struct {
+	// Keys are keys of fields with sensitive values and their mask modes. Keys are matched case-insensitively,
+	// keys of objects logged (e.g. with zap.Reflect) are matched as well.
+	Keys map[string]MaskMode
+
+	// Headers are names of HTTP headers with sensitive values and their mask modes. Names are matched
+	// case-insensitively with keys of objects logged (e.g. with HTTPHeader), and with header fields
+	// of the LoggingHandler middleware prefixed with "ih_" and "oh_".
+	Headers map[string]MaskMode
+
+	// Patterns are patterns of sensitive values in messages and in string values of fields.
+	Patterns []RedactPattern
+}
+
+// DefaultRedactConfig returns the redaction config of NewProduction: fields of phone numbers, user hashes,
+// callback URLs and credentials, credential headers, and emails, phone numbers in international format,
+// card numbers and JWTs in strings.
+func DefaultRedactConfig() RedactConfig {
+	return RedactConfig{
+		Keys: map[string]MaskMode{
+			"phone_number": MaskPartial,
+			"phone_code":   MaskFull,
+			"user_hash":    MaskPartial,
+			"callback_url": MaskURL,
+			"email":        MaskEmail,
+			"card_number":  MaskPartial,
+			"password":     MaskFull,
+			"secret":       MaskFull,
+			"token":        MaskFull,
+		},
+		Headers: map[string]MaskMode{
+			"Authorization": MaskFull,
+			"Cookie":        MaskFull,
+			"Set-Cookie":    MaskFull,
+			"X-Api-Key":     MaskFull,
+		},
+		Patterns: []RedactPattern{
+			{Regexp: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Mode: MaskFull},
+			{Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), Mode: MaskEmail},
+			{Regexp: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Mode: MaskPartial, Valid: luhnValid},
+			{Regexp: regexp.MustCompile(`\+\d[\d ()-]{6,}\d`), Mode: MaskPartial},
+		},
+	}
+}
+
+// NewRedactCore wraps the core to redact sensitive data of log entries before encoding them.
+func NewRedactCore(core zapcore.Core, config RedactConfig) zapcore.Core {
+	r := &redactor{
+		keys:     make(map[string]MaskMode, len(config.Keys)),
+		headers:  make(map[string]MaskMode, len(config.Headers)),
+		patterns: config.Patterns,
+	}
+	for k, m := range config.Keys {
+		r.keys[strings.ToLower(k)] = m
+	}
+	for h, m := range config.Headers {
+		r.headers[strings.ToLower(h)] = m
+	}
+	return &redactCore{Core: core, r: r}
+}
+
+// WrapRedactCore returns an option wrapping the core of the logger to redact sensitive data, see NewRedactCore.
+func WrapRedactCore(config RedactConfig) zap.Option {
+	return zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return NewRedactCore(c, config)
+	})
+}
+
+// redactCore redacts entries written to the wrapped core.
+type redactCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+// Check lets the wrapped core decide on writing the entry, so sampling and levels of teed cores apply.
+// The entry checked by the wrapped core is written by a checkedRedactCore once the fields are redacted,
+// which returns it to the pool of checked entries.
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	inner := c.Core.Check(ent, nil)
+	if inner == nil {
+		return ce
+	}
+
+	cc := checkedRedactCorePool.Get().(*checkedRedactCore)
+	cc.redactCore, cc.inner = c, inner
+	return ce.AddCore(ent, cc)
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.text(ent.Message)
+	return c.Core.Write(ent, c.r.fields(fields))
+}
+
+var checkedRedactCorePool = sync.Pool{New: func() interface{} { return &checkedRedactCore{} }}
+
+// checkedRedactCore writes a redacted entry to the entry checked by the wrapped core.
+type checkedRedactCore struct {
+	*redactCore
+	inner *zapcore.CheckedEntry
+}
+
+func (c *checkedRedactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	inner := c.inner
+	inner.Entry = ent
+	inner.Entry.Message = c.r.text(ent.Message)
+	if inner.ErrorOutput == nil {
+		inner.ErrorOutput = zapcore.Lock(os.Stderr)
+	}
+	inner.Write(c.r.fields(fields)...)
+
+	c.redactCore, c.inner = nil, nil
+	checkedRedactCorePool.Put(c)
+	return nil
+}
+
+type redactor struct {
+	keys     map[string]MaskMode
+	headers  map[string]MaskMode
+	patterns []RedactPattern
+}
+
+// fields returns redacted fields, the slice is copied when any field is redacted.
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, f := range fields {
+		rf, ok := r.field(f)
+		if !ok {
+			continue
+		}
+		if redacted == nil {
+			redacted = make([]zapcore.Field, len(fields))
+			copy(redacted, fields)
+		}
+		redacted[i] = rf
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
+
+// field returns the redacted field and whether it was redacted.
+func (r *redactor) field(f zapcore.Field) (zapcore.Field, bool) {
+	if m, ok := r.fieldMode(f.Key); ok {
+		if f.Type == zapcore.StringType {
+			return zap.String(f.Key, maskString(f.String, m)), true
+		}
+		return zap.Any(f.Key, maskValue(fieldValue(f), m)), true
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		if s := r.text(f.String); s != f.String {
+			return zap.String(f.Key, s), true
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			if s := r.text(err.Error()); s != err.Error() {
+				return zap.NamedError(f.Key, errors.New(s)), true
+			}
+		}
+	case zapcore.StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok {
+			if rs := r.text(s.String()); rs != s.String() {
+				return zap.String(f.Key, rs), true
+			}
+		}
+	case zapcore.ReflectType:
+		// values which can't be inspected are masked, so sensitive data can't slip through
+		b, err := json.Marshal(f.Interface)
+		if err != nil {
+			return zap.String(f.Key, mask), true
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return zap.String(f.Key, mask), true
+		}
+		if v, ok := r.value(v); ok {
+			return zap.Any(f.Key, v), true
+		}
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		if v, ok := r.value(fieldValue(f)); ok {
+			return zap.Any(f.Key, v), true
+		}
+	}
+	return f, false
+}
+
+// fieldMode returns the mask mode of the field key: configured keys, and headers prefixed as by LoggingHandler.
+func (r *redactor) fieldMode(key string) (MaskMode, bool) {
+	key = strings.ToLower(key)
+	if m, ok := r.keys[key]; ok {
+		return m, true
+	}
+	for _, prefix := range []string{"ih_", "oh_"} {
+		if h := strings.TrimPrefix(key, prefix); h != key {
+			m, ok := r.headers[h]
+			return m, ok
+		}
+	}
+	return 0, false
+}
+
+// value returns the redacted value of a decoded object and whether it was redacted.
+func (r *redactor) value(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		s := r.text(v)
+		return s, s != v
+	case map[string]interface{}:
+		var redacted map[string]interface{}
+		for k, x := range v {
+			rx, ok := r.keyValue(k, x)
+			if !ok {
+				continue
+			}
+			if redacted == nil {
+				redacted = make(map[string]interface{}, len(v))
+				for k, x := range v {
+					redacted[k] = x
+				}
+			}
+			redacted[k] = rx
+		}
+		if redacted == nil {
+			return v, false
+		}
+		return redacted, true
+	case []interface{}:
+		var redacted []interface{}
+		for i, x := range v {
+			rx, ok := r.value(x)
+			if !ok {
+				continue
+			}
+			if redacted == nil {
+				redacted = make([]interface{}, len(v))
+				copy(redacted, v)
+			}
+			redacted[i] = rx
+		}
+		if redacted == nil {
+			return v, false
+		}
+		return redacted, true
+	default:
+		return v, false
+	}
+}
+
+func (r *redactor) keyValue(k string, v interface{}) (interface{}, bool) {
+	lk := strings.ToLower(k)
+	if m, ok := r.keys[lk]; ok {
+		return maskValue(v, m), true
+	}
+	if m, ok := r.headers[lk]; ok {
+		return maskValue(v, m), true
+	}
+	return r.value(v)
+}
+
+// text returns the string with values matching patterns masked.
+func (r *redactor) text(s string) string {
+	for _, p := range r.patterns {
+		s = p.Regexp.ReplaceAllStringFunc(s, func(v string) string {
+			if p.Valid != nil && !p.Valid(v) {
+				return v
+			}
+			return maskString(v, p.Mode)
+		})
+	}
+	return s
+}
+
+// fieldValue returns the value of the field as added to an object.
+func fieldValue(f zapcore.Field) interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return enc.Fields[f.Key]
+}
+
+func maskValue(v interface{}, m MaskMode) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return maskString(v, m)
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, x := range v {
+			masked[i] = maskValue(x, m)
+		}
+		return masked
+	case []string:
+		masked := make([]string, len(v))
+		for i, x := range v {
+			masked[i] = maskString(x, m)
+		}
+		return masked
+	case map[string]interface{}:
+		return mask
+	default:
+		return maskString(fmt.Sprint(v), m)
+	}
+}
+
+func maskString(s string, m MaskMode) string {
+	switch m {
+	case MaskPartial:
+		if n := utf8.RuneCountInString(s); n >= partialMaskMinLength {
+			runes := []rune(s)
+			return mask + string(runes[n-partialMaskKeep:])
+		}
+	case MaskEmail:
+		if i := strings.LastIndexByte(s, '@'); i > 0 {
+			_, size := utf8.DecodeRuneInString(s)
+			return s[:size] + mask + s[i:]
+		}
+	case MaskURL:
+		if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+			return u.Scheme + "://" + u.Host + "/" + mask
+		}
+	}
+	return mask
+}
+
+// luhnValid reports whether the digits of the string pass the Luhn check, as card numbers do.
+func luhnValid(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
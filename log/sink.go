@@ -0,0 +1,216 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultMaxSize        = 100 << 20 // 100 MiB
+	defaultMaxBackups     = 5
+	defaultSyslogFacility = 16 // local0
+
+	// rfc5424Time is the timestamp format of RFC5424 messages.
+	rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// rotatingFile is a file rotated when it reaches the maximal size. Rotated files are renamed
+// with a number suffix, the path.1 being the most recent one, and only maxBackups of them are kept.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write implements io.Writer.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("rotate %s: %w", r.path, err)
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(r.backup(r.maxBackups))
+	for i := r.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.backup(1)); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return r.path + "." + strconv.Itoa(i)
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (r *rotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Sync()
+}
+
+// Close implements io.Closer.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// syslogCore writes entries to a syslog server as RFC5424 messages, one message per UDP datagram (RFC5426).
+// The severity of the messages is the syslog code of the entry level, as encoded by the syslog level encoder.
+type syslogCore struct {
+	enc      zapcore.Encoder
+	conn     net.Conn
+	facility int
+	hostname string
+	appName  string
+	procID   string
+}
+
+func newSyslogCore(enc zapcore.Encoder, address string, facility int, appName string) (*syslogCore, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	return &syslogCore{
+		enc:      enc,
+		conn:     conn,
+		facility: facility,
+		hostname: hostname,
+		appName:  appName,
+		procID:   strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+// Enabled implements zapcore.LevelEnabler, entries are filtered by the logger levels.
+func (c *syslogCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	var msg bytes.Buffer
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	fmt.Fprintf(&msg, "<%d>1 %s %s %s %s - - ",
+		c.facility*8+syslogCode(ent.Level), ent.Time.UTC().Format(rfc5424Time), c.hostname, c.appName, c.procID)
+	msg.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+
+	_, err = c.conn.Write(msg.Bytes())
+	return err
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
+
+// callerCore drops the caller of entries below the level.
+type callerCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *callerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &callerCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *callerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *callerCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < c.level {
+		ent.Caller = zapcore.EntryCaller{}
+	}
+	return c.Core.Write(ent, fields)
+}
@@ -0,0 +1,321 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedirectSlog sets the slog default logger to write to the global logger (see ReplaceGlobals). It takes effect
+// immediately and follows the global logger replaced later, so it's enough to call it once, e.g. in main.
+// Libraries shouldn't call it, as it replaces the slog default logger of the whole program.
+func RedirectSlog() {
+	slog.SetDefault(slog.New(NewSlogHandler(nil)))
+	// slog.SetDefault redirects the standard library's logger to slog, redirect it to zap directly again
+	zap.RedirectStdLog(zap.L())
+}
+
+// slogHandler is a slog.Handler writing to a zap logger.
+type slogHandler struct {
+	l      *zap.Logger // the global logger when nil
+	fields []zapcore.Field
+	groups []string // groups opened after the last attributes, omitted unless attributes are added to them
+}
+
+// NewSlogHandler returns a slog.Handler writing to the zap logger, or to the global logger (see ReplaceGlobals)
+// when l is nil. Records are logged with the caller of the slog call, and with fields carried by the context
+// of the call (see IntoContext), e.g. the correlation ID. Groups are logged as namespaces of the fields.
+func NewSlogHandler(l *zap.Logger) slog.Handler {
+	return &slogHandler{l: l}
+}
+
+func (h *slogHandler) logger() *zap.Logger {
+	if h.l != nil {
+		return h.l
+	}
+	mu.RLock()
+	l := wrappedZapLogger
+	mu.RUnlock()
+	return l
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger().Core().Enabled(zapLevel(level))
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	ce := h.logger().Check(zapLevel(r.Level), r.Message)
+	if ce == nil {
+		return nil
+	}
+
+	if !r.Time.IsZero() {
+		ce.Time = r.Time
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		ce.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		ce.Caller.Function = frame.Function
+	}
+
+	ctxFields := ContextFields(ctx)
+	fields := make([]zapcore.Field, 0, len(ctxFields)+len(h.fields)+len(h.groups)+r.NumAttrs())
+	fields = append(fields, ctxFields...)
+	fields = append(fields, h.fields...)
+	if r.NumAttrs() > 0 {
+		attrs := make([]slog.Attr, 0, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = append(attrs, a)
+			return true
+		})
+		if attrFields := slogFields(attrs); len(attrFields) > 0 {
+			for _, g := range h.groups {
+				fields = append(fields, zap.Namespace(g))
+			}
+			fields = append(fields, attrFields...)
+		}
+	}
+
+	ce.Write(fields...)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	attrFields := slogFields(attrs)
+	if len(attrFields) == 0 {
+		return h
+	}
+
+	fields := make([]zapcore.Field, 0, len(h.fields)+len(h.groups)+len(attrFields))
+	fields = append(fields, h.fields...)
+	for _, g := range h.groups {
+		fields = append(fields, zap.Namespace(g))
+	}
+	fields = append(fields, attrFields...)
+	return &slogHandler{l: h.l, fields: fields}
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := make([]string, len(h.groups), len(h.groups)+1)
+	copy(groups, h.groups)
+	return &slogHandler{l: h.l, fields: h.fields, groups: append(groups, name)}
+}
+
+// zapLevel returns the zap level of the slog level, levels between slog levels are rounded down.
+func zapLevel(l slog.Level) zapcore.Level {
+	switch {
+	case l < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case l < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case l < slog.LevelError:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
+
+// slogFields returns fields of the attributes, empty attributes and groups are omitted.
+func slogFields(attrs []slog.Attr) []zapcore.Field {
+	var fields []zapcore.Field
+	for _, a := range attrs {
+		fields = appendSlogField(fields, a)
+	}
+	return fields
+}
+
+func appendSlogField(fields []zapcore.Field, a slog.Attr) []zapcore.Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindGroup:
+		groupFields := slogFields(v.Group())
+		if len(groupFields) == 0 {
+			return fields
+		}
+		// attributes of a group without a key are inlined
+		if a.Key == "" {
+			return append(fields, groupFields...)
+		}
+		return append(fields, zap.Object(a.Key, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, f := range groupFields {
+				f.AddTo(enc)
+			}
+			return nil
+		})))
+	case slog.KindString:
+		return append(fields, zap.String(a.Key, v.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(a.Key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(a.Key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(a.Key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(a.Key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(a.Key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(a.Key, v.Time()))
+	default:
+		if err, ok := v.Any().(error); ok {
+			return append(fields, zap.NamedError(a.Key, err))
+		}
+		return append(fields, zap.Any(a.Key, v.Any()))
+	}
+}
+
+// slogCore is a zap core writing to a slog.Handler.
+type slogCore struct {
+	h slog.Handler
+}
+
+// NewSlogCore returns a zap core writing to the slog handler. Fields are logged as attributes,
+// namespaces as groups, and the logger name and the stacktrace as "logger" and "stacktrace" attributes.
+func NewSlogCore(h slog.Handler) zapcore.Core {
+	return &slogCore{h: h}
+}
+
+func (c *slogCore) Enabled(l zapcore.Level) bool {
+	return c.h.Enabled(context.Background(), slogLevel(l))
+}
+
+func (c *slogCore) With(fields []zapcore.Field) zapcore.Core {
+	h := c.h
+	var attrs []slog.Attr
+	for _, f := range fields {
+		if f.Type == zapcore.NamespaceType {
+			if len(attrs) > 0 {
+				h = h.WithAttrs(attrs)
+				attrs = nil
+			}
+			h = h.WithGroup(f.Key)
+			continue
+		}
+		attrs = append(attrs, fieldAttrs(f)...)
+	}
+	if len(attrs) > 0 {
+		h = h.WithAttrs(attrs)
+	}
+	return &slogCore{h: h}
+}
+
+func (c *slogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *slogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var pc uintptr
+	if ent.Caller.Defined {
+		pc = ent.Caller.PC
+	}
+	r := slog.NewRecord(ent.Time, slogLevel(ent.Level), ent.Message, pc)
+
+	if ent.LoggerName != "" {
+		r.AddAttrs(slog.String("logger", ent.LoggerName))
+	}
+	r.AddAttrs(namespacedAttrs(fields)...)
+	if ent.Stack != "" {
+		r.AddAttrs(slog.String("stacktrace", ent.Stack))
+	}
+
+	return c.h.Handle(context.Background(), r)
+}
+
+func (c *slogCore) Sync() error {
+	return nil
+}
+
+// slogLevel returns the slog level of the zap level, levels above ErrorLevel are above slog.LevelError.
+func slogLevel(l zapcore.Level) slog.Level {
+	switch {
+	case l <= zapcore.DebugLevel:
+		return slog.LevelDebug
+	case l == zapcore.InfoLevel:
+		return slog.LevelInfo
+	case l == zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError + slog.Level(l-zapcore.ErrorLevel)
+	}
+}
+
+// namespacedAttrs returns attributes of the fields, fields following a namespace are grouped in it.
+func namespacedAttrs(fields []zapcore.Field) []slog.Attr {
+	for i, f := range fields {
+		if f.Type != zapcore.NamespaceType {
+			continue
+		}
+		attrs := fieldsAttrs(fields[:i])
+		if nested := namespacedAttrs(fields[i+1:]); len(nested) > 0 {
+			attrs = append(attrs, slog.Attr{Key: f.Key, Value: slog.GroupValue(nested...)})
+		}
+		return attrs
+	}
+	return fieldsAttrs(fields)
+}
+
+func fieldsAttrs(fields []zapcore.Field) []slog.Attr {
+	var attrs []slog.Attr
+	for _, f := range fields {
+		attrs = append(attrs, fieldAttrs(f)...)
+	}
+	return attrs
+}
+
+// fieldAttrs returns attributes of the field, fields such as errors add more than one key.
+func fieldAttrs(f zapcore.Field) []slog.Attr {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, valueAttr(k, enc.Fields[k]))
+	}
+	return attrs
+}
+
+func valueAttr(key string, v interface{}) slog.Attr {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return slog.Any(key, v)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, valueAttr(k, m[k]))
+	}
+	return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+}
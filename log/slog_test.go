@@ -0,0 +1,100 @@
+//go:build go1.21
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSlogHandler(t *testing.T) {
+	r := require.New(t)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := slog.New(NewSlogHandler(zap.New(core)))
+
+	ctx := IntoContext(context.Background(), CorrelationID("cid"))
+	l.With("user_id", 1).WithGroup("http").WithGroup("empty").DebugContext(ctx, "filtered")
+	l.With("user_id", 1).WithGroup("http").InfoContext(ctx, "request",
+		"status", 200, slog.Group("client", "ip", "10.0.0.1"), slog.Group("none"))
+	l.WithGroup("empty").Warn("no attributes", "err", errors.New("boom"))
+
+	r.Equal(2, logs.Len())
+
+	e := logs.All()[0]
+	r.Equal(zapcore.InfoLevel, e.Level)
+	r.Equal("request", e.Message)
+	r.Equal("slog_test.go", filepath.Base(e.Caller.File))
+	r.Equal(map[string]interface{}{
+		"correlation_id": "cid",
+		"user_id":        int64(1),
+		"http": map[string]interface{}{
+			"status": int64(200),
+			"client": map[string]interface{}{"ip": "10.0.0.1"},
+		},
+	}, e.ContextMap())
+
+	e = logs.All()[1]
+	r.Equal(zapcore.WarnLevel, e.Level)
+	r.Equal(map[string]interface{}{"empty": map[string]interface{}{"err": "boom"}}, e.ContextMap())
+}
+
+func TestSlogDefault(t *testing.T) {
+	r := require.New(t)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	ReplaceGlobals(zap.New(NewRedactCore(core, DefaultRedactConfig()), zap.AddCaller()))
+	defer ReplaceGlobals(zap.NewNop())
+
+	defer slog.SetDefault(slog.Default())
+	RedirectSlog()
+
+	slog.Error("sent to john@example.com", "phone_number", "+37060012345")
+
+	r.Equal(1, logs.Len())
+	e := logs.All()[0]
+	r.Equal(zapcore.ErrorLevel, e.Level)
+	r.Equal("sent to j*****@example.com", e.Message)
+	r.Equal("*****2345", e.ContextMap()["phone_number"])
+	r.Equal("slog_test.go", filepath.Base(e.Caller.File))
+}
+
+func TestSlogCore(t *testing.T) {
+	r := require.New(t)
+
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := zap.New(NewSlogCore(h)).Named("payments").With(zap.String("env", "test"))
+
+	l.Debug("filtered")
+	l.Warn("slow request", zap.Int("status", 200), zap.Namespace("db"), zap.Duration("latency", 0), zap.String("table", "deals"))
+
+	var got map[string]interface{}
+	r.NoError(json.Unmarshal(buf.Bytes(), &got))
+	r.Equal(map[string]interface{}{
+		"level":  "WARN",
+		"msg":    "slow request",
+		"env":    "test",
+		"logger": "payments",
+		"status": float64(200),
+		"db":     map[string]interface{}{"latency": float64(0), "table": "deals"},
+	}, got)
+}
@@ -0,0 +1,68 @@
+package log
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/log"
+	"go.uber.org/zap/zapcore"
+)
+
+// ContextFieldsInterceptor is a Temporal worker interceptor adding fields carried by the activity context
+// (see IntoContext) to the logger returned by activity.GetLogger, e.g. fields of the worker's
+// BackgroundActivityContext:
+//
+//	w := worker.New(c, taskQueue, worker.Options{
+//		BackgroundActivityContext: log.IntoContext(context.Background(), zap.String("service", "payments")),
+//		Interceptors:              []interceptor.WorkerInterceptor{log.NewContextFieldsInterceptor()},
+//	})
+type ContextFieldsInterceptor struct {
+	interceptor.WorkerInterceptorBase
+}
+
+// NewContextFieldsInterceptor creates a new ContextFieldsInterceptor.
+func NewContextFieldsInterceptor() *ContextFieldsInterceptor {
+	return &ContextFieldsInterceptor{}
+}
+
+// InterceptActivity implements interceptor.WorkerInterceptor.
+func (*ContextFieldsInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &contextFieldsActivityInbound{ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next}}
+}
+
+type contextFieldsActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+func (a *contextFieldsActivityInbound) Init(outbound interceptor.ActivityOutboundInterceptor) error {
+	return a.Next.Init(&contextFieldsActivityOutbound{ActivityOutboundInterceptorBase: interceptor.ActivityOutboundInterceptorBase{Next: outbound}})
+}
+
+type contextFieldsActivityOutbound struct {
+	interceptor.ActivityOutboundInterceptorBase
+}
+
+func (a *contextFieldsActivityOutbound) GetLogger(ctx context.Context) log.Logger {
+	l := a.Next.GetLogger(ctx)
+	fields := ContextFields(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+
+	switch l := l.(type) {
+	case *ZapAdapter:
+		return l.WithContext(ctx)
+	case log.WithLogger:
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		keyvals := make([]interface{}, 0, 2*len(enc.Fields))
+		for k, v := range enc.Fields {
+			keyvals = append(keyvals, k, v)
+		}
+		return l.With(keyvals...)
+	default:
+		return l
+	}
+}
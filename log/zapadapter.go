@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 
 	"go.temporal.io/sdk/log"
@@ -82,6 +83,11 @@ func (log *ZapAdapter) With(keyvals ...interface{}) log.Logger {
 	return &ZapAdapter{Zl: log.Zl.With(log.fields(keyvals)...)}
 }
 
+// WithContext returns a child logger logging fields carried by the context, see IntoContext.
+func (log *ZapAdapter) WithContext(ctx context.Context) *ZapAdapter {
+	return &ZapAdapter{Zl: log.Zl.With(ContextFields(ctx)...)}
+}
+
 // GetZap returns a child logger with the provided keyvals.
 func (log *ZapAdapter) GetZap() *zap.Logger {
 	return log.Zl
@@ -0,0 +1,144 @@
+// Package admin provides a single handler serving service administration endpoints:
+// Prometheus metrics, expvar variables, pprof profiles and health checks.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/monetha/mth-core/web/middleware/healthcheck"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config is the admin handler configuration.
+type Config struct {
+	// Gatherer is the Prometheus gatherer served on /metrics. Defaults to prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	// EnablePprof enables pprof endpoints under /debug/pprof/.
+	EnablePprof bool
+
+	// Token is a static token expected in "Authorization: Bearer <token>" request header.
+	Token string
+
+	// AllowedNetworks is a list of CIDRs (e.g. "10.0.0.0/8") requests are allowed from.
+	// The remote address of the connection is checked, forwarding headers are ignored.
+	AllowedNetworks []string
+}
+
+// Handler serves /metrics, /debug/vars, /debug/pprof/ (when enabled), /health and /health/dependencies.
+// When token or allowed networks are configured, a request is allowed if it either has the token
+// or comes from an allowed network. Health endpoints never require authorization.
+type Handler struct {
+	mux      *http.ServeMux
+	token    []byte
+	networks []*net.IPNet
+}
+
+// NewHandler creates new admin Handler.
+func NewHandler(c Config) (*Handler, error) {
+	h := &Handler{
+		mux:   http.NewServeMux(),
+		token: []byte(c.Token),
+	}
+
+	for _, cidr := range c.AllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("admin: invalid allowed network: %v", err)
+		}
+		h.networks = append(h.networks, network)
+	}
+
+	gatherer := c.Gatherer
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+
+	h.mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	h.mux.Handle("/debug/vars", expvar.Handler())
+	if c.EnablePprof {
+		h.mux.HandleFunc("/debug/pprof/", pprof.Index)
+		h.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		h.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		h.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		h.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	h.mux.Handle("/health", healthcheck.Handler(http.NotFoundHandler()))
+	h.mux.HandleFunc("/health/dependencies", dependenciesHandler)
+
+	return h, nil
+}
+
+// Handle registers additional admin endpoint for the given pattern.
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isHealthPath(r.URL.Path) && !h.authorized(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if len(h.token) == 0 && len(h.networks) == 0 {
+		return true
+	}
+
+	if len(h.token) > 0 {
+		auth := r.Header.Get("Authorization")
+		if token := strings.TrimPrefix(auth, "Bearer "); token != auth &&
+			subtle.ConstantTimeCompare([]byte(token), h.token) == 1 {
+			return true
+		}
+	}
+
+	if len(h.networks) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range h.networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func isHealthPath(path string) bool {
+	return path == "/health" || path == "/health/dependencies"
+}
+
+// dependenciesHandler responds with health statuses of service dependencies,
+// the status code is 503 when any of dependencies is failing.
+func dependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := healthcheck.GetStatuses()
+
+	status := http.StatusOK
+	for _, healthy := range statuses {
+		if !healthy {
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(statuses)
+}
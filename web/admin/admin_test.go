@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerAuthorization(t *testing.T) {
+	r := require.New(t)
+
+	h, err := NewHandler(Config{
+		Gatherer:        prometheus.NewRegistry(),
+		Token:           "secret",
+		AllowedNetworks: []string{"10.0.0.0/8"},
+	})
+	r.NoError(err)
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		auth       string
+		status     int
+	}{
+		{"no token", "/metrics", "192.168.1.1:1234", "", http.StatusForbidden},
+		{"wrong token", "/metrics", "192.168.1.1:1234", "Bearer wrong", http.StatusForbidden},
+		{"token", "/metrics", "192.168.1.1:1234", "Bearer secret", http.StatusOK},
+		{"allowed network", "/debug/vars", "10.1.2.3:1234", "", http.StatusOK},
+		{"health", "/health", "192.168.1.1:1234", "", http.StatusOK},
+		{"pprof disabled", "/debug/pprof/", "10.1.2.3:1234", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			require.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestNewHandlerInvalidNetwork(t *testing.T) {
+	_, err := NewHandler(Config{AllowedNetworks: []string{"10.0.0.0"}})
+	require.Error(t, err)
+}
@@ -1,6 +1,10 @@
 package web
 
-import "context"
+import (
+	"context"
+
+	"github.com/monetha/mth-core/log"
+)
 
 // The key type is unexported to prevent collisions with context keys defined in
 // other packages.
@@ -17,7 +21,9 @@ func CorrelationID(ctx context.Context) (cID string) {
 	return
 }
 
-// WithCorrelationID returns a new Context carrying correlation ID.
+// WithCorrelationID returns a new Context carrying correlation ID. The correlation ID is added
+// to fields logged by log.FromContext as well.
 func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	ctx = log.IntoContext(ctx, log.CorrelationID(correlationID))
 	return context.WithValue(ctx, contextKey, correlationID)
 }
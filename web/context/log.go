@@ -7,9 +7,10 @@ import (
 )
 
 // NewLogger returns a request-scoped logger. Use this to log info/errors
-// Will automatically log request correlation id.
+// Will automatically log request correlation id, when set, and fields carried by the context, see log.IntoContext.
 func NewLogger(ctx context.Context) *log.Logger {
-	correlationID := CorrelationID(ctx)
-	correlationIDField := log.CorrelationID(correlationID)
-	return log.With(correlationIDField)
+	if correlationID := CorrelationID(ctx); correlationID != "" {
+		ctx = log.IntoContext(ctx, log.CorrelationID(correlationID))
+	}
+	return log.FromContext(ctx)
 }
@@ -5,11 +5,13 @@ import (
 )
 
 // LogStatusReponseWriter wraps http.ResponseWriter and logs status code.
-// Logged status code can be retrieved later by calling Status() method.
+// Logged status code can be retrieved later by calling Status() method,
+// number of written body bytes by calling Size() method.
 type LogStatusReponseWriter struct {
 	http.ResponseWriter
 	status      int
 	wroteHeader bool
+	size        int64
 }
 
 // NewLogStatusReponseWriter creates an instance of LogStatusReponseWriter
@@ -22,12 +24,19 @@ func (w *LogStatusReponseWriter) Status() int {
 	return w.status
 }
 
+// Size returns number of bytes written to the response body
+func (w *LogStatusReponseWriter) Size() int64 {
+	return w.size
+}
+
 // Write implements http.ResponseWriter interface
 func (w *LogStatusReponseWriter) Write(p []byte) (n int, err error) {
 	if !w.wroteHeader {
 		w.WriteHeader(w.status)
 	}
-	return w.ResponseWriter.Write(p)
+	n, err = w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return
 }
 
 // WriteHeader implements http.ResponseWriter interface
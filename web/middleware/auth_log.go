@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/monetha/mth-core/log"
+	"github.com/monetha/mth-core/web/header"
+)
+
+// AuthLogHandler adds authorization token claims of the request to fields logged by log.FromContext,
+// prefixed with "c_" as in the access log of LoggingHandler, so all logs of the request identify its principal.
+func AuthLogHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := header.AuthClaims(r); len(claims) > 0 {
+			ctx := log.IntoContext(r.Context(), log.FieldsFrom(adjustKeysWithPrefix(claims, "c"))...)
+			r = r.WithContext(ctx)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
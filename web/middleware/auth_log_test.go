@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monetha/mth-core/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAuthLogHandler(t *testing.T) {
+	r := require.New(t)
+
+	var fields map[string]interface{}
+	h := CorrelationIDHandler(AuthLogHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range log.ContextFields(req.Context()) {
+			f.AddTo(enc)
+		}
+		fields = enc.Fields
+	})))
+
+	claims := base64.RawStdEncoding.EncodeToString([]byte(`{"sub":"42"}`))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer header."+claims+".signature")
+	req.Header.Set("mth-correlation-id", "cid")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	r.Equal(map[string]interface{}{"correlation_id": "cid", "c_sub": "42"}, fields)
+}
@@ -52,7 +52,8 @@ func LoggingHandler(h http.Handler, parameters LoggingParameters) http.Handler {
 			path = path + "?" + raw
 		}
 
-		l := log.With(
+		// fields carried by the request context are logged too, fields of the access log replace them
+		ctx := log.IntoContext(r.Context(),
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.Int("status_code", statusCode),
@@ -60,8 +61,9 @@ func LoggingHandler(h http.Handler, parameters LoggingParameters) http.Handler {
 			zap.Duration("latency", latency),
 			zap.String("client_ip", clientIP),
 		)
+		ctx = log.IntoContext(ctx, log.FieldsFrom(adjustKeysWithPrefix(authClaims, "c"))...)
+		l := log.FromContext(ctx)
 		l = l.WithOptions(zap.AddStacktrace(zap.DPanicLevel)) // Do not include stacktrace for Error level and lower
-		l = l.With(log.FieldsFrom(adjustKeysWithPrefix(authClaims, "c"))...)
 
 		reqHeaderFields := getHeaderFields(r.Header, parameters.HeaderKeys, "ih")
 		reqHeaderLoggingFields := log.FieldsFrom(reqHeaderFields)
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/monetha/mth-core/data/metrics"
+	"github.com/monetha/mth-core/web"
+)
+
+const (
+	// UnknownRoute is the route label value of requests the route name resolver couldn't resolve.
+	UnknownRoute = "unknown"
+)
+
+// RouteNameResolver returns the route template of the request (e.g. "/users/{id}"),
+// or empty string when the request doesn't match any route.
+// It must never return raw request paths, they would blow up metrics cardinality.
+type RouteNameResolver func(r *http.Request) string
+
+// redirectHandlerType is the type of handlers http.ServeMux returns for requests it redirects.
+var redirectHandlerType = reflect.TypeOf(http.RedirectHandler("/", http.StatusMovedPermanently))
+
+// ServeMuxRouteName returns RouteNameResolver that resolves the route as the pattern of
+// the mux handler matching the request. Requests the mux redirects or doesn't match
+// are left unresolved, as the mux may return the request path for them.
+func ServeMuxRouteName(mux *http.ServeMux) RouteNameResolver {
+	return func(r *http.Request) string {
+		h, pattern := mux.Handler(r)
+		if reflect.TypeOf(h) == redirectHandlerType {
+			return ""
+		}
+		return pattern
+	}
+}
+
+// MetricsParameters contains metrics middleware configuration
+type MetricsParameters struct {
+	// RouteName resolves the route label of requests. When it's nil, all requests
+	// are recorded with UnknownRoute route.
+	RouteName RouteNameResolver
+
+	// MaxCardinality limits the number of tracked method, route and status class combinations.
+	// Defaults to metrics.DefaultMaxCardinality.
+	MaxCardinality int
+
+	// DurationExportOptions configure how request durations are exported to Prometheus.
+	// Defaults to Prometheus Histogram with default buckets.
+	DurationExportOptions []metrics.ExportOption
+}
+
+// MetricsHandler is a middleware that records request rate, errors and duration (RED) metrics
+type MetricsHandler struct {
+	routeName RouteNameResolver
+
+	requests     *metrics.RateVec
+	duration     *metrics.TimerVec
+	requestSize  *metrics.HistogramVec
+	responseSize *metrics.HistogramVec
+
+	inFlightMu sync.Mutex
+	inFlightN  int64
+	inFlight   *metrics.Gauge
+}
+
+// NewMetricsHandler creates new MetricsHandler and registers its metrics in the registry
+func NewMetricsHandler(registry *metrics.Registry, parameters MetricsParameters) (*MetricsHandler, error) {
+	durationOpts := parameters.DurationExportOptions
+	if durationOpts == nil {
+		durationOpts = []metrics.ExportOption{metrics.AsHistogram(nil)}
+	}
+
+	vecOpts := metrics.VecOpts{
+		LabelNames:     []string{"method", "route", "status"},
+		MaxCardinality: parameters.MaxCardinality,
+	}
+
+	mh := &MetricsHandler{
+		routeName:    parameters.RouteName,
+		requests:     metrics.NewRateVec(vecOpts),
+		duration:     metrics.NewTimerVec(vecOpts),
+		requestSize:  metrics.NewHistogramVec(vecOpts),
+		responseSize: metrics.NewHistogramVec(vecOpts),
+		inFlight:     metrics.NewGauge(),
+	}
+
+	registrations := []struct {
+		name     string
+		register func(name string) error
+	}{
+		{"requests", func(name string) error { return registry.RegisterRateVec(name, mh.requests) }},
+		{"request_duration", func(name string) error { return registry.RegisterTimerVec(name, mh.duration, durationOpts...) }},
+		{"request_size", func(name string) error { return registry.RegisterHistogramVec(name, mh.requestSize, "bytes") }},
+		{"response_size", func(name string) error { return registry.RegisterHistogramVec(name, mh.responseSize, "bytes") }},
+		{"requests_in_flight", func(name string) error { return registry.RegisterGauge(name, mh.inFlight, "count") }},
+	}
+	for i, reg := range registrations {
+		if err := reg.register(reg.name); err != nil {
+			for _, registered := range registrations[:i] {
+				registry.Unregister(registered.name)
+			}
+			return nil, err
+		}
+	}
+
+	return mh, nil
+}
+
+// Handler records metrics of requests served by h.
+// It should wrap the handler recovering panics, otherwise panicking requests are recorded with 500 status.
+func (mh *MetricsHandler) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mh.addInFlight(1)
+
+		body := &countingReadCloser{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		lrw := web.NewLogStatusReponseWriter(w)
+
+		defer func() {
+			mh.addInFlight(-1)
+
+			status := lrw.Status()
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+
+			requestSize := body.n
+			if r.ContentLength > requestSize {
+				requestSize = r.ContentLength
+			}
+
+			lvs := []string{normalizeMethod(r.Method), mh.route(r), statusClass(status)}
+			mh.requests.WithLabelValues(lvs...).Mark(1)
+			mh.duration.WithLabelValues(lvs...).Update(time.Since(start))
+			mh.requestSize.WithLabelValues(lvs...).Update(requestSize)
+			mh.responseSize.WithLabelValues(lvs...).Update(lrw.Size())
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		h.ServeHTTP(lrw, r)
+	})
+}
+
+func (mh *MetricsHandler) route(r *http.Request) string {
+	if mh.routeName == nil {
+		return UnknownRoute
+	}
+	if route := mh.routeName(r); route != "" {
+		return route
+	}
+	return UnknownRoute
+}
+
+func (mh *MetricsHandler) addInFlight(n int64) {
+	mh.inFlightMu.Lock()
+	mh.inFlightN += n
+	mh.inFlight.Update(mh.inFlightN)
+	mh.inFlightMu.Unlock()
+}
+
+var statusClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+func statusClass(status int) string {
+	if status >= 100 && status < 600 {
+		return statusClasses[status/100-1]
+	}
+	return "other"
+}
+
+// normalizeMethod maps non-standard methods to a single label value to bound metrics cardinality
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// countingReadCloser counts bytes read from the underlying reader
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return
+}
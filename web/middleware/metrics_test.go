@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"expvar"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/monetha/mth-core/data/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	r := require.New(t)
+
+	preg := prometheus.NewRegistry()
+	registry := metrics.NewRegistry("http", metrics.WithRegisterer(preg), metrics.WithExpvarRoot(new(expvar.Map).Init()))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	})
+
+	mh, err := NewMetricsHandler(registry, MetricsParameters{RouteName: ServeMuxRouteName(mux)})
+	r.NoError(err)
+	h := mh.Handler(mux)
+
+	for _, path := range []string{"/users/1", "/users/2", "/other"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader("body")))
+	}
+
+	r.NoError(testutil.GatherAndCompare(preg, strings.NewReader(`
+# HELP http_requests_total requests
+# TYPE http_requests_total counter
+http_requests_total{method="POST",route="/users/",status="4xx"} 2
+http_requests_total{method="POST",route="unknown",status="4xx"} 1
+# HELP http_requests_in_flight_count requests_in_flight
+# TYPE http_requests_in_flight_count gauge
+http_requests_in_flight_count 0
+`), "http_requests_total", "http_requests_in_flight_count"))
+}
+
+func TestServeMuxRouteNameUnmatched(t *testing.T) {
+	r := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {})
+	routeName := ServeMuxRouteName(mux)
+
+	random := fmt.Sprintf("r%d", rand.Int63())
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/"+random, nil),
+		httptest.NewRequest(http.MethodGet, "/users", nil),
+		httptest.NewRequest(http.MethodGet, "/users//"+random, nil),
+		httptest.NewRequest(http.MethodGet, "/users/../"+random, nil),
+		{Method: http.MethodConnect, Host: "example.com", URL: &url.URL{Path: "/users"}},
+	} {
+		r.Empty(routeName(req), req.URL.Path)
+	}
+	r.Equal("/users/", routeName(httptest.NewRequest(http.MethodGet, "/users/"+random, nil)))
+}
+
+func TestStatusClass(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal("2xx", statusClass(http.StatusNoContent))
+	r.Equal("5xx", statusClass(http.StatusBadGateway))
+	r.Equal("other", statusClass(999))
+}
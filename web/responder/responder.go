@@ -7,7 +7,6 @@ import (
 	"github.com/go-openapi/runtime"
 	"github.com/monetha/mth-core/http/errcode"
 	"github.com/monetha/mth-core/log"
-	webcontext "github.com/monetha/mth-core/web/context"
 )
 
 // Responder implements middleware.Responder, to use while generating responses in our handlers.
@@ -49,12 +48,8 @@ type Responder struct {
 func New(req *http.Request) (resp *Responder) {
 	resp = &Responder{req: req}
 
-	// Set up logger with correlation ID if it's existing. Otherwise, use a logger without correlation ID.
-	if cID := webcontext.CorrelationID(req.Context()); len(cID) > 0 {
-		resp.l = log.With(log.CorrelationID(cID))
-	} else {
-		resp.l = log.With()
-	}
+	// Set up logger with fields of the request context, including correlation ID if it's existing.
+	resp.l = log.FromContext(req.Context())
 
 	return resp
 }